@@ -0,0 +1,294 @@
+package kodo
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/go-sdk/v7/auth"
+	qc "github.com/qiniu/go-sdk/v7/client"
+	"github.com/qiniu/go-sdk/v7/conf"
+	qs "github.com/qiniu/go-sdk/v7/storage"
+)
+
+// APIs in qs.BucketManager send requests with context.Background(), so that
+// cancellation and deadline of the incoming context can't abort them. We build
+// management requests by ourselves here and send them with the given context.
+
+// callAPI will send a management request signed by qiniu token and decode the
+// response into ret, the request is limited by l.
+func callAPI(ctx context.Context, m *qs.BucketManager, l *requestLimiter, ret interface{}, method, reqURL string, form url.Values) (err error) {
+	if m.Mac == nil {
+		return errCredentialRequired
+	}
+	if err = l.wait(ctx); err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", conf.CONTENT_TYPE_FORM)
+	}
+	err = m.Mac.AddToken(auth.TokenQiniu, req)
+	if err != nil {
+		return err
+	}
+
+	return doRequest(ctx, m.Client, req, ret)
+}
+
+// doRequest will send req and decode the response into ret.
+func doRequest(ctx context.Context, clt *qc.Client, req *http.Request, ret interface{}) (err error) {
+	resp, err := clt.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		cerr := resp.Body.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		return newResponseError(resp)
+	}
+	if ret == nil || resp.ContentLength == 0 {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err == io.EOF {
+		// Response with chunked encoding could have an empty body.
+		return nil
+	}
+	return err
+}
+
+// ref: https://developer.qiniu.com/kodo/1308/stat
+func (s *Storage) statObject(ctx context.Context, key string) (fi qs.FileInfo, err error) {
+	host, err := s.rsHost(ctx)
+	if err != nil {
+		return
+	}
+
+	err = callAPI(ctx, s.bucket, s.metadataLimiter, &fi, http.MethodPost, host+qs.URIStat(s.name, key), nil)
+	return
+}
+
+// batchStatResult is the result of a stat operation in batch.
+type batchStatResult struct {
+	Code int `json:"code"`
+	Data struct {
+		qs.FileInfo
+		// Error is the error message of failed operation.
+		Error string `json:"error"`
+	} `json:"data"`
+}
+
+// ref: https://developer.qiniu.com/kodo/1250/batch
+func (s *Storage) batchStat(ctx context.Context, keys []string) (rets []batchStatResult, err error) {
+	host, err := s.rsHost(ctx)
+	if err != nil {
+		return
+	}
+
+	form := url.Values{}
+	for _, v := range keys {
+		form.Add("op", qs.URIStat(s.name, v))
+	}
+	err = callAPI(ctx, s.bucket, s.metadataLimiter, &rets, http.MethodPost, host+"/batch", form)
+	return
+}
+
+// ref: https://developer.qiniu.com/kodo/1257/delete
+func (s *Storage) deleteObject(ctx context.Context, key string) (err error) {
+	host, err := s.rsHost(ctx)
+	if err != nil {
+		return
+	}
+
+	return callAPI(ctx, s.bucket, s.metadataLimiter, nil, http.MethodPost, host+qs.URIDelete(s.name, key), nil)
+}
+
+// listObjectsResult is the response of list api.
+type listObjectsResult struct {
+	Marker         string        `json:"marker"`
+	Items          []qs.ListItem `json:"items"`
+	CommonPrefixes []string      `json:"commonPrefixes"`
+}
+
+// ref: https://developer.qiniu.com/kodo/1284/list
+func (s *Storage) listObjects(ctx context.Context, prefix, delimiter, marker string, limit int) (ret listObjectsResult, err error) {
+	host, err := s.rsfHost(ctx)
+	if err != nil {
+		return
+	}
+
+	query := url.Values{}
+	query.Set("bucket", s.name)
+	query.Set("limit", strconv.Itoa(limit))
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if marker != "" {
+		query.Set("marker", marker)
+	}
+
+	err = callAPI(ctx, s.bucket, s.metadataLimiter, &ret, http.MethodPost, host+"/list?"+query.Encode(), nil)
+	return
+}
+
+// downloadURL returns the url to download key from download domain.
+//
+// The url is signed by timestamp anti-leech key if it's set, otherwise it's
+// signed by private url token unless the storager is anonymous.
+//
+// ref: https://developer.qiniu.com/kodo/1202/download-token
+func (s *Storage) downloadURL(domain, key string, lifetime time.Duration) (string, error) {
+	deadline := s.clock.now().Add(lifetime).Unix()
+
+	switch {
+	case s.timestampAuthKey != "":
+		return signTimestampURL(qs.MakePublicURL(domain, key), s.timestampAuthKey, deadline)
+	case s.anonymous:
+		return qs.MakePublicURL(domain, key), nil
+	case s.bucket.Mac == nil:
+		return "", errCredentialRequired
+	default:
+		return qs.MakePrivateURL(s.bucket.Mac, domain, key, deadline), nil
+	}
+}
+
+// doSigned sends the download request created by newRequest, which is
+// signed with time of clock. If the request is rejected while a new clock
+// skew is detected from the response, it will be signed and sent again once.
+func (s *Storage) doSigned(ctx context.Context, limiter *requestLimiter, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for retried := false; ; retried = true {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		if err = limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := s.bucket.Client.Do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if s.clock.observe(resp) && isAuthFailure(resp.StatusCode) && !retried {
+			resp.Body.Close()
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// signTimestampURL signs url with cdn timestamp anti-leech key.
+//
+// cdn.CreateTimestampAntileechURL is not used because it always counts
+// deadline from local time.
+//
+// ref: https://developer.qiniu.com/fusion/kb/1670/timestamp-hotlinking-prevention
+func signTimestampURL(rawURL, key string, deadline int64) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	t := strconv.FormatInt(deadline, 16)
+	sum := md5.Sum([]byte(key + u.EscapedPath() + t))
+
+	q := url.Values{}
+	q.Set("sign", hex.EncodeToString(sum[:]))
+	q.Set("t", t)
+	if u.RawQuery == "" {
+		return u.String() + "?" + q.Encode(), nil
+	}
+	return u.String() + "&" + q.Encode(), nil
+}
+
+// tryDomains will call fn with download domains until it succeeds or fails
+// with a non-retryable error, and returns the last tried domain.
+//
+// Domains failed with retryable errors are put into cooldown.
+func (s *Storage) tryDomains(fn func(domain string) error) (domain string, err error) {
+	for _, domain = range s.domains.candidates() {
+		err = fn(domain)
+		if err == nil {
+			s.domains.markHealthy(domain)
+			return domain, nil
+		}
+		if !isRetryableError(err) {
+			return domain, err
+		}
+		s.domains.markFailed(domain)
+	}
+	return domain, err
+}
+
+// headObject sends HEAD request to download domains, which doesn't need the
+// secret key for public buckets.
+func (s *Storage) headObject(ctx context.Context, key string) (header http.Header, err error) {
+	_, err = s.tryDomains(func(domain string) error {
+		resp, err := s.doSigned(ctx, s.metadataLimiter, func() (*http.Request, error) {
+			reqURL, err := s.downloadURL(domain, key, s.urlLifetime)
+			if err != nil {
+				return nil, err
+			}
+			return http.NewRequestWithContext(ctx, http.MethodHead, reqURL, nil)
+		})
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return newResponseError(resp)
+		}
+		header = resp.Header
+		return nil
+	})
+	return
+}
+
+// ref: https://developer.qiniu.com/kodo/1382/mkbucketv3
+func (s *Service) createBucket(ctx context.Context, name string, region qs.RegionID) (err error) {
+	reqURL := fmt.Sprintf("%s/mkbucketv3/%s/region/%s", s.ucHost, name, region)
+	return callAPI(ctx, s.service, s.metadataLimiter, nil, http.MethodPost, reqURL, nil)
+}
+
+// ref: https://developer.qiniu.com/kodo/1601/drop-bucket
+func (s *Service) dropBucket(ctx context.Context, name string) (err error) {
+	reqURL := fmt.Sprintf("%s/drop/%s", s.ucHost, name)
+	return callAPI(ctx, s.service, s.metadataLimiter, nil, http.MethodPost, reqURL, nil)
+}
+
+// ref: https://developer.qiniu.com/kodo/3926/get-service
+func (s *Service) listBuckets(ctx context.Context) (buckets []string, err error) {
+	reqURL := fmt.Sprintf("%s/buckets?shared=false", s.ucHost)
+	err = callAPI(ctx, s.service, s.metadataLimiter, &buckets, http.MethodPost, reqURL, nil)
+	return
+}
@@ -0,0 +1,60 @@
+package kodo
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const defaultURLLifetime = time.Hour
+
+// clock is used to sign download urls with time of kodo.
+//
+// The deadline of a download url is checked by the server, so local clock
+// skew could make urls expire earlier or later than expected. clock adds a
+// fixed skew to local time, and the skew could be detected from the Date
+// header of responses. clock is safe for concurrent use.
+type clock struct {
+	// skew is the offset added to local time in nanoseconds.
+	skew   int64
+	detect bool
+}
+
+func newClock(skew time.Duration, detect bool) *clock {
+	return &clock{
+		skew:   int64(skew),
+		detect: detect,
+	}
+}
+
+// now returns the current time of kodo.
+func (c *clock) now() time.Time {
+	return time.Now().Add(time.Duration(atomic.LoadInt64(&c.skew)))
+}
+
+// observe will update skew from the Date header of resp if detect is enabled,
+// and reports whether skew is changed.
+func (c *clock) observe(resp *http.Response) bool {
+	if !c.detect || resp == nil {
+		return false
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+
+	skew := date.Sub(time.Now())
+	// Date header only has seconds precision, ignore skew within it.
+	if skew > -time.Second && skew < time.Second {
+		skew = 0
+	}
+	old := time.Duration(atomic.SwapInt64(&c.skew, int64(skew)))
+	diff := skew - old
+	return diff <= -time.Second || diff >= time.Second
+}
+
+// isAuthFailure reports whether the signed download url is rejected, which
+// could be caused by clock skew.
+func isAuthFailure(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
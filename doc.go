@@ -1,5 +1,10 @@
 /*
 Package kodo provided support for qiniu kodo object storage (https://www.qiniu.com/en/products/kodo)
+
+Methods of Storage beyond types.Storager, like WriteObject, could be called
+by type assertion on the Storager returned by NewStorager:
+
+	o, err := store.(*kodo.Storage).WriteObject("path/to/file", r, size)
 */
 package kodo
 
@@ -0,0 +1,100 @@
+package kodo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/beyondstorage/go-endpoint"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+const defaultEndpointCooldown = 30 * time.Second
+
+// ReadResult is the result of a read.
+type ReadResult struct {
+	// Endpoint is the download domain which served the read, like `https://example.com`.
+	Endpoint string
+}
+
+// domainPool holds download domains in priority order with their health.
+//
+// A domain is put into cooldown after it failed, and it's tried only after
+// all healthy domains during cooldown. domainPool is safe for concurrent use.
+type domainPool struct {
+	cooldown time.Duration
+
+	mu        sync.Mutex
+	domains   []string
+	coolUntil []time.Time
+}
+
+// newDomainPool parses endpoints into download domains.
+func newDomainPool(endpoints []string, cooldown time.Duration) (*domainPool, error) {
+	p := &domainPool{
+		cooldown:  cooldown,
+		domains:   make([]string, 0, len(endpoints)),
+		coolUntil: make([]time.Time, len(endpoints)),
+	}
+
+	for _, v := range endpoints {
+		ep, err := endpoint.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var url string
+		switch ep.Protocol() {
+		case endpoint.ProtocolHTTPS:
+			url, _, _ = ep.HTTPS()
+		case endpoint.ProtocolHTTP:
+			url, _, _ = ep.HTTP()
+		default:
+			return nil, services.PairUnsupportedError{Pair: ps.WithEndpoint(v)}
+		}
+		p.domains = append(p.domains, url)
+	}
+	return p, nil
+}
+
+// candidates returns domains to try, healthy domains go first and domains
+// in cooldown go last, both in priority order.
+func (p *domainPool) candidates() []string {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	healthy := make([]string, 0, len(p.domains))
+	var cooling []string
+	for i, v := range p.domains {
+		if now.Before(p.coolUntil[i]) {
+			cooling = append(cooling, v)
+		} else {
+			healthy = append(healthy, v)
+		}
+	}
+	return append(healthy, cooling...)
+}
+
+// markFailed puts domain into cooldown.
+func (p *domainPool) markFailed(domain string) {
+	p.mark(domain, time.Now().Add(p.cooldown))
+}
+
+// markHealthy ends the cooldown of domain.
+func (p *domainPool) markHealthy(domain string) {
+	p.mark(domain, time.Time{})
+}
+
+func (p *domainPool) mark(domain string, coolUntil time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, v := range p.domains {
+		if v == domain {
+			p.coolUntil[i] = coolUntil
+			return
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package kodo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReadConcurrency    = 1
+	defaultReadPartSize       = 8 * 1024 * 1024
+	defaultReadResumeAttempts = 3
+)
+
+// getObject sends GET request of key to download domains.
+//
+// The range starts from offset with given size, size < 0 means reading to
+// the end. etag will be sent as If-Match if it's not empty.
+func (s *Storage) getObject(ctx context.Context, key string, lifetime time.Duration, offset, size int64, etag string) (resp *http.Response, domain string, err error) {
+	domain, err = s.tryDomains(func(domain string) error {
+		resp, err = s.doSigned(ctx, s.dataLimiter, func() (*http.Request, error) {
+			url, err := s.downloadURL(domain, key, lifetime)
+			if err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			if offset > 0 || size >= 0 {
+				req.Header.Set("Range", formatRange(offset, size))
+			}
+			if etag != "" {
+				req.Header.Set("If-Match", strconv.Quote(etag))
+			}
+			return req, nil
+		})
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			defer resp.Body.Close()
+			return newResponseError(resp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, domain, err
+	}
+	return resp, domain, nil
+}
+
+// formatRange formats the Range header, size < 0 means reading to the end.
+func formatRange(offset, size int64) string {
+	if size < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+size-1)
+}
+
+// parseContentRange returns the range and total size in Content-Range
+// header like `bytes 0-99/1000`, last is inclusive.
+func parseContentRange(v string) (first, last, total int64, err error) {
+	_, err = fmt.Sscanf(v, "bytes %d-%d/%d", &first, &last, &total)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid content range %q: %w", v, err)
+	}
+	return
+}
+
+// copyRange copies the range starting from offset with given size out of
+// the whole content in resp, which is returned by domains not supporting
+// range requests. size < 0 means reading to the end. resp.Body will be
+// closed.
+func copyRange(w io.Writer, resp *http.Response, offset, size int64) (n int64, err error) {
+	defer resp.Body.Close()
+
+	if _, err = io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+		return 0, err
+	}
+	var r io.Reader = resp.Body
+	if size >= 0 {
+		r = io.LimitReader(r, size)
+	}
+	return io.Copy(w, r)
+}
+
+// errorCaptureReader records the error returned by r, so that failures of
+// reading could be told apart from failures of writing in io.Copy.
+type errorCaptureReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *errorCaptureReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return
+}
+
+// copyWithResume will copy body of resp into w. If the body is interrupted
+// midway, the remaining range will be requested again with If-Match of the
+// etag in resp, at most resumes times. The etag of resumed responses is
+// checked as well, in case If-Match is ignored.
+//
+// resp is the response of range starting from offset with given size, size
+// < 0 means reading to the end. resp.Body will be closed.
+func (s *Storage) copyWithResume(ctx context.Context, w io.Writer, resp *http.Response, key string, lifetime time.Duration,
+	offset, size int64, resumes int) (n int64, err error) {
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+
+	for attempt := 0; ; attempt++ {
+		body := &errorCaptureReader{r: resp.Body}
+		written, err := io.Copy(w, body)
+		resp.Body.Close()
+		n += written
+
+		if err == nil || body.err == nil {
+			// Succeeded or failed while writing.
+			return n, err
+		}
+		// Object without etag could not be protected from changing.
+		if attempt >= resumes || etag == "" || !isRetryableError(err) {
+			return n, err
+		}
+
+		remaining := int64(-1)
+		if size >= 0 {
+			remaining = size - n
+		}
+		err = s.retry.do(ctx, func() (err error) {
+			resp, _, err = s.getObject(ctx, key, lifetime, offset+n, remaining, etag)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode != http.StatusPartialContent {
+				resp.Body.Close()
+				return fmt.Errorf("unexpected status %d for range request", resp.StatusCode)
+			}
+			if err = checkEtag(resp, etag); err != nil {
+				resp.Body.Close()
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// checkEtag returns an error if the etag of resp is not the expected one,
+// which happens while If-Match is ignored by the download domain, like
+// some cdn domains. Empty etag is not checked.
+func checkEtag(resp *http.Response, etag string) error {
+	if etag == "" {
+		return nil
+	}
+	if got := strings.Trim(resp.Header.Get("ETag"), `"`); got != etag {
+		return fmt.Errorf("object is changed while reading: expect etag %s, got %s", etag, got)
+	}
+	return nil
+}
+
+type partRange struct {
+	offset int64
+	size   int64
+}
+
+type partResult struct {
+	data []byte
+	err  error
+}
+
+// readParallel will read the object by concurrent range requests, and write
+// them into w in order.
+//
+// The first part is written as soon as it arrives, and at most concurrency
+// parts are buffered in memory. Parts are retried separately, and they are
+// protected by If-Match with the etag of the first part.
+func (s *Storage) readParallel(ctx context.Context, w io.Writer, key string, lifetime time.Duration,
+	offset, size, partSize int64, concurrency, resumes int) (n int64, domain string, err error) {
+	firstSize := partSize
+	if size >= 0 && size < partSize {
+		firstSize = size
+	}
+
+	var resp *http.Response
+	err = s.retry.do(ctx, func() (err error) {
+		resp, domain, err = s.getObject(ctx, key, lifetime, offset, firstSize, "")
+		return err
+	})
+	if err != nil {
+		return 0, domain, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		n, err = copyRange(w, resp, offset, size)
+		return n, domain, err
+	}
+
+	_, last, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		resp.Body.Close()
+		return 0, domain, err
+	}
+	end := total
+	if size >= 0 && offset+size < total {
+		end = offset + size
+	}
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+
+	var parts []partRange
+	for start := last + 1; start < end; start += partSize {
+		ps := partSize
+		if start+ps > end {
+			ps = end - start
+		}
+		parts = append(parts, partRange{offset: start, size: ps})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// sem limits parts in flight, it's released after the part is written.
+	sem := make(chan struct{}, concurrency)
+	results := make([]chan partResult, len(parts))
+	for i := range results {
+		results[i] = make(chan partResult, 1)
+	}
+	go func() {
+		for i, p := range parts {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int, p partRange) {
+				data, err := s.readPart(ctx, key, lifetime, p, etag)
+				results[i] <- partResult{data: data, err: err}
+			}(i, p)
+		}
+	}()
+
+	n, err = s.copyWithResume(ctx, w, resp, key, lifetime, offset, last+1-offset, resumes)
+	if err != nil {
+		return n, domain, err
+	}
+	for i := range parts {
+		var r partResult
+		select {
+		case r = <-results[i]:
+		case <-ctx.Done():
+			return n, domain, ctx.Err()
+		}
+		if r.err != nil {
+			return n, domain, r.err
+		}
+
+		written, err := w.Write(r.data)
+		n += int64(written)
+		if err != nil {
+			return n, domain, err
+		}
+		<-sem
+	}
+	return n, domain, nil
+}
+
+// readPart reads a part into memory with retries.
+func (s *Storage) readPart(ctx context.Context, key string, lifetime time.Duration, p partRange, etag string) (data []byte, err error) {
+	data = make([]byte, p.size)
+	err = s.retry.do(ctx, func() error {
+		resp, _, err := s.getObject(ctx, key, lifetime, p.offset, p.size, etag)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusPartialContent {
+			return fmt.Errorf("unexpected status %d for range request", resp.StatusCode)
+		}
+		if err = checkEtag(resp, etag); err != nil {
+			return err
+		}
+		_, err = io.ReadFull(resp.Body, data)
+		return err
+	})
+	return
+}
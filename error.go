@@ -0,0 +1,90 @@
+package kodo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	qc "github.com/qiniu/go-sdk/v7/client"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// errCredentialRequired is returned for operations which need the access key
+// and secret key, while the storager is created with upload token only.
+var errCredentialRequired = fmt.Errorf("%w: hmac credential is required", services.ErrPermissionDenied)
+
+// ErrChecksumMismatch is returned while the qetag of content written or read
+// doesn't match the hash of object in kodo.
+var ErrChecksumMismatch = services.NewErrorCode("checksum mismatch")
+
+// ErrChecksumUnverifiable is returned while content read should be verified,
+// but the hash of object in kodo is not a qetag. It's the case for objects
+// uploaded by multipart upload with parts other than 4MB.
+var ErrChecksumUnverifiable = services.NewErrorCode("checksum unverifiable")
+
+// ResponseError is the error responded by kodo.
+//
+// Qiniu support requires the request ID for every ticket, use errors.As to
+// retrieve it from the error returned by Storager or Servicer:
+//
+//	var e *kodo.ResponseError
+//	if errors.As(err, &e) {
+//	    log.Printf("kodo request %s failed: %s", e.RequestID, e.Message)
+//	}
+type ResponseError struct {
+	// Code is the code returned by kodo, which looks like http status code but could be 6xx or 7xx.
+	Code int
+	// Message is the error message returned by kodo.
+	Message string
+	// RequestID is the value of `X-Reqid` header.
+	RequestID string
+	// Log is the value of `X-Log` header, it could be empty.
+	Log string
+
+	// err is the classified error, like services.ErrObjectNotExist.
+	err error
+}
+
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("%s (code: %d, request id: %s)", e.Message, e.Code, e.RequestID)
+	if e.err == nil {
+		return msg
+	}
+	return fmt.Sprintf("%v: %s", e.err, msg)
+}
+
+// Unwrap returns the classified error, so that errors.Is works with errors defined in services.
+func (e *ResponseError) Unwrap() error {
+	return e.err
+}
+
+// newResponseError creates a ResponseError from a failed http response.
+func newResponseError(resp *http.Response) *ResponseError {
+	e := qc.ResponseError(resp).(*qc.ErrorInfo)
+
+	re := convertErrorInfo(e)
+	re.Log = resp.Header.Get("X-Log")
+	return re
+}
+
+func convertErrorInfo(e *qc.ErrorInfo) *ResponseError {
+	return &ResponseError{
+		Code:      e.Code,
+		Message:   e.Err,
+		RequestID: e.Reqid,
+	}
+}
+
+// getErrorCode returns the code responded by kodo.
+func getErrorCode(err error) (code int, ok bool) {
+	var re *ResponseError
+	if errors.As(err, &re) {
+		return re.Code, true
+	}
+	var e *qc.ErrorInfo
+	if errors.As(err, &e) {
+		return e.Code, true
+	}
+	return 0, false
+}
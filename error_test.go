@@ -0,0 +1,44 @@
+package kodo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	qc "github.com/qiniu/go-sdk/v7/client"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+func TestFormatError(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		expect    error
+		requestID string
+	}{
+		{"response error", &ResponseError{Code: 612, RequestID: "a"}, services.ErrObjectNotExist, "a"},
+		{"wrapped response error", fmt.Errorf("part 1: %w", &ResponseError{Code: 403, RequestID: "b"}),
+			services.ErrPermissionDenied, "b"},
+		{"wrapped error info", fmt.Errorf("query region: %w", &qc.ErrorInfo{Code: 573, Reqid: "c"}),
+			services.ErrRequestThrottled, "c"},
+		{"unexpected", errors.New("boom"), services.ErrUnexpected, ""},
+		{"context canceled", fmt.Errorf("query region: %w", context.Canceled), context.Canceled, ""},
+		{"deadline exceeded", fmt.Errorf("read: %w", context.DeadlineExceeded), context.DeadlineExceeded, ""},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := formatError(tt.err)
+			if !errors.Is(err, tt.expect) {
+				t.Errorf("expect %v, got %v", tt.expect, err)
+			}
+
+			var re *ResponseError
+			if errors.As(err, &re) != (tt.requestID != "") || (re != nil && re.RequestID != tt.requestID) {
+				t.Errorf("unexpected request id of %v", err)
+			}
+		})
+	}
+}
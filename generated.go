@@ -66,6 +66,46 @@ func setStorageSystemMetadata(s *StorageMeta, sm StorageSystemMetadata) {
 	s.SetSystemMetadata(sm)
 }
 
+// WithAPIEndpoint will apply api_endpoint value to Options.
+//
+// APIEndpoint set endpoint for kodo apis like up, rs, rsf and uc, all apis will be sent to this endpoint
+func WithAPIEndpoint(v string) Pair {
+	return Pair{
+		Key:   "api_endpoint",
+		Value: v,
+	}
+}
+
+// WithClockSkew will apply clock_skew value to Options.
+//
+// ClockSkew set clock skew in seconds which is added to local time while signing download urls
+func WithClockSkew(v int) Pair {
+	return Pair{
+		Key:   "clock_skew",
+		Value: v,
+	}
+}
+
+// WithContentCrc32 will apply content_crc32 value to Options.
+//
+// ContentCrc32 set precomputed CRC32 (IEEE) of content, the upload is rejected if content doesn't match
+func WithContentCrc32(v uint32) Pair {
+	return Pair{
+		Key:   "content_crc32",
+		Value: v,
+	}
+}
+
+// WithDataQPS will apply data_qps value to Options.
+//
+// DataQPS set max requests per second of data operations like upload and download, which is shared by concurrent operations
+func WithDataQPS(v int) Pair {
+	return Pair{
+		Key:   "data_qps",
+		Value: v,
+	}
+}
+
 // WithDefaultServicePairs will apply default_service_pairs value to Options.
 //
 // DefaultServicePairs set default pairs for service actions
@@ -86,6 +126,166 @@ func WithDefaultStoragePairs(v DefaultStoragePairs) Pair {
 	}
 }
 
+// WithDetectClockSkew will apply detect_clock_skew value to Options.
+//
+// DetectClockSkew set whether to detect clock skew from the Date header of download responses, it's ignored if clock_skew is set
+func WithDetectClockSkew(v bool) Pair {
+	return Pair{
+		Key:   "detect_clock_skew",
+		Value: v,
+	}
+}
+
+// WithEndpointCooldown will apply endpoint_cooldown value to Options.
+//
+// EndpointCooldown set cooldown in seconds of a failed download endpoint, it's tried after healthy ones during cooldown
+func WithEndpointCooldown(v int) Pair {
+	return Pair{
+		Key:   "endpoint_cooldown",
+		Value: v,
+	}
+}
+
+// WithEndpoints will apply endpoints value to Options.
+//
+// Endpoints set download endpoints in priority order, they are tried after endpoint while reading
+func WithEndpoints(v []string) Pair {
+	return Pair{
+		Key:   "endpoints",
+		Value: v,
+	}
+}
+
+// WithLogger will apply logger value to Options.
+//
+// Logger set logger to record every http request in debug level, signatures, tokens and access keys are redacted
+func WithLogger(v Logger) Pair {
+	return Pair{
+		Key:   "logger",
+		Value: v,
+	}
+}
+
+// WithMetadataQPS will apply metadata_qps value to Options.
+//
+// MetadataQPS set max requests per second of metadata operations like stat, list, delete and bucket management, which is shared by concurrent operations and inherited by storages of the service unless they set their own
+func WithMetadataQPS(v int) Pair {
+	return Pair{
+		Key:   "metadata_qps",
+		Value: v,
+	}
+}
+
+// WithObserver will apply observer value to Options.
+//
+// Observer set observer which is notified around every operation for metrics and tracing
+func WithObserver(v Observer) Pair {
+	return Pair{
+		Key:   "observer",
+		Value: v,
+	}
+}
+
+// WithPutPolicy will apply put_policy value to Options.
+//
+// PutPolicy set put policy for uploading, like callback, size and mime limits
+func WithPutPolicy(v PutPolicy) Pair {
+	return Pair{
+		Key:   "put_policy",
+		Value: v,
+	}
+}
+
+// WithPutResult will apply put_result value to Options.
+//
+// PutResult set a PutResult to receive the key, hash and response body of the upload
+func WithPutResult(v *PutResult) Pair {
+	return Pair{
+		Key:   "put_result",
+		Value: v,
+	}
+}
+
+// WithRateLimit will apply rate_limit value to Options.
+//
+// RateLimit set max bytes per second of this operation, storage level limits still apply
+func WithRateLimit(v int64) Pair {
+	return Pair{
+		Key:   "rate_limit",
+		Value: v,
+	}
+}
+
+// WithReadConcurrency will apply read_concurrency value to Options.
+//
+// ReadConcurrency set how many range requests could be sent concurrently while reading a large object, 1 means no parallel read
+func WithReadConcurrency(v int) Pair {
+	return Pair{
+		Key:   "read_concurrency",
+		Value: v,
+	}
+}
+
+// WithReadPartSize will apply read_part_size value to Options.
+//
+// ReadPartSize set size in bytes of range requests in parallel read
+func WithReadPartSize(v int64) Pair {
+	return Pair{
+		Key:   "read_part_size",
+		Value: v,
+	}
+}
+
+// WithReadRateLimit will apply read_rate_limit value to Options.
+//
+// ReadRateLimit set max bytes per second of all reads on the storage, which is shared by concurrent reads
+func WithReadRateLimit(v int64) Pair {
+	return Pair{
+		Key:   "read_rate_limit",
+		Value: v,
+	}
+}
+
+// WithReadResult will apply read_result value to Options.
+//
+// ReadResult set a ReadResult to receive the endpoint which served the read
+func WithReadResult(v *ReadResult) Pair {
+	return Pair{
+		Key:   "read_result",
+		Value: v,
+	}
+}
+
+// WithReadResumeAttempts will apply read_resume_attempts value to Options.
+//
+// ReadResumeAttempts set max times to resume a read interrupted midway from the last received byte, 0 means no resume
+func WithReadResumeAttempts(v int) Pair {
+	return Pair{
+		Key:   "read_resume_attempts",
+		Value: v,
+	}
+}
+
+// WithRetryMaxAttempts will apply retry_max_attempts value to Options.
+//
+// RetryMaxAttempts set max attempts for retryable requests, 1 means no retry
+func WithRetryMaxAttempts(v int) Pair {
+	return Pair{
+		Key:   "retry_max_attempts",
+		Value: v,
+	}
+}
+
+// WithRetryMaxDelay will apply retry_max_delay value to Options.
+//
+// RetryMaxDelay set max backoff delay between retries in milliseconds
+func WithRetryMaxDelay(v int) Pair {
+	return Pair{
+		Key:   "retry_max_delay",
+		Value: v,
+	}
+}
+
 // WithServiceFeatures will apply service_features value to Options.
 //
 // ServiceFeatures set service features
@@ -96,6 +296,16 @@ func WithServiceFeatures(v ServiceFeatures) Pair {
 	}
 }
 
+// WithSkipUnchanged will apply skip_unchanged value to Options.
+//
+// SkipUnchanged set to skip the upload if the remote object has the same qetag and size as content, which must be an io.ReadSeeker
+func WithSkipUnchanged(v bool) Pair {
+	return Pair{
+		Key:   "skip_unchanged",
+		Value: v,
+	}
+}
+
 // WithStorageClass will apply storage_class value to Options.
 //
 // StorageClass
@@ -116,30 +326,172 @@ func WithStorageFeatures(v StorageFeatures) Pair {
 	}
 }
 
+// WithTimestampAuthKey will apply timestamp_auth_key value to Options.
+//
+// TimestampAuthKey set key of cdn timestamp anti-leech, download urls will be signed by it instead of private url token
+func WithTimestampAuthKey(v string) Pair {
+	return Pair{
+		Key:   "timestamp_auth_key",
+		Value: v,
+	}
+}
+
+// WithUploadRecordExpiry will apply upload_record_expiry value to Options.
+//
+// UploadRecordExpiry set expiry in seconds of upload records, expired records are dropped and uploads restart
+func WithUploadRecordExpiry(v int) Pair {
+	return Pair{
+		Key:   "upload_record_expiry",
+		Value: v,
+	}
+}
+
+// WithUploadRecorder will apply upload_recorder value to Options.
+//
+// UploadRecorder set recorder to persist progress of multipart uploads, so that they could be resumed after restart
+func WithUploadRecorder(v Recorder) Pair {
+	return Pair{
+		Key:   "upload_recorder",
+		Value: v,
+	}
+}
+
+// WithUploadSourceID will apply upload_source_id value to Options.
+//
+// UploadSourceID set identity of the source like its path, size and modified time, uploads are resumed only for the same source
+func WithUploadSourceID(v string) Pair {
+	return Pair{
+		Key:   "upload_source_id",
+		Value: v,
+	}
+}
+
+// WithUploadToken will apply upload_token value to Options.
+//
+// UploadToken set an upload token issued by others, storager with upload token only could write objects and create dirs
+func WithUploadToken(v string) Pair {
+	return Pair{
+		Key:   "upload_token",
+		Value: v,
+	}
+}
+
+// WithUploadTokenFunc will apply upload_token_func value to Options.
+//
+// UploadTokenFunc set a function to fetch upload tokens issued by others, it's called before every upload
+func WithUploadTokenFunc(v UploadTokenFunc) Pair {
+	return Pair{
+		Key:   "upload_token_func",
+		Value: v,
+	}
+}
+
+// WithUploadTokenLifetime will apply upload_token_lifetime value to Options.
+//
+// UploadTokenLifetime set lifetime of upload tokens in seconds, tokens are cached and reissued before expiring
+func WithUploadTokenLifetime(v int) Pair {
+	return Pair{
+		Key:   "upload_token_lifetime",
+		Value: v,
+	}
+}
+
+// WithURLLifetime will apply url_lifetime value to Options.
+//
+// URLLifetime set lifetime of signed download urls in seconds
+func WithURLLifetime(v int) Pair {
+	return Pair{
+		Key:   "url_lifetime",
+		Value: v,
+	}
+}
+
+// WithVerifyChecksum will apply verify_checksum value to Options.
+//
+// VerifyChecksum set to verify content read against the qetag of object, reading object whose hash is not a qetag fails with ErrChecksumUnverifiable
+func WithVerifyChecksum(v bool) Pair {
+	return Pair{
+		Key:   "verify_checksum",
+		Value: v,
+	}
+}
+
+// WithWritePartSize will apply write_part_size value to Options.
+//
+// WritePartSize set size in bytes of parts in multipart upload, which is used for writing with unknown size. It's 4MB by default, the hash of object uploaded by parts of other sizes is not a qetag
+func WithWritePartSize(v int64) Pair {
+	return Pair{
+		Key:   "write_part_size",
+		Value: v,
+	}
+}
+
+// WithWriteRateLimit will apply write_rate_limit value to Options.
+//
+// WriteRateLimit set max bytes per second of all writes on the storage, which is shared by concurrent writes
+func WithWriteRateLimit(v int64) Pair {
+	return Pair{
+		Key:   "write_rate_limit",
+		Value: v,
+	}
+}
+
 var pairMap = map[string]string{
+	"api_endpoint":          "string",
+	"clock_skew":            "int",
+	"content_crc32":         "uint32",
 	"content_md5":           "string",
 	"content_type":          "string",
 	"context":               "context.Context",
 	"continuation_token":    "string",
 	"credential":            "string",
+	"data_qps":              "int",
 	"default_service_pairs": "DefaultServicePairs",
 	"default_storage_pairs": "DefaultStoragePairs",
+	"detect_clock_skew":     "bool",
 	"endpoint":              "string",
+	"endpoint_cooldown":     "int",
+	"endpoints":             "[]string",
 	"expire":                "int",
 	"http_client_options":   "*httpclient.Options",
 	"interceptor":           "Interceptor",
 	"io_callback":           "func([]byte)",
 	"list_mode":             "ListMode",
 	"location":              "string",
+	"logger":                "Logger",
+	"metadata_qps":          "int",
 	"multipart_id":          "string",
 	"name":                  "string",
 	"object_mode":           "ObjectMode",
+	"observer":              "Observer",
 	"offset":                "int64",
+	"put_policy":            "PutPolicy",
+	"put_result":            "*PutResult",
+	"rate_limit":            "int64",
+	"read_concurrency":      "int",
+	"read_part_size":        "int64",
+	"read_rate_limit":       "int64",
+	"read_result":           "*ReadResult",
+	"read_resume_attempts":  "int",
+	"retry_max_attempts":    "int",
+	"retry_max_delay":       "int",
 	"service_features":      "ServiceFeatures",
 	"size":                  "int64",
+	"skip_unchanged":        "bool",
 	"storage_class":         "int",
 	"storage_features":      "StorageFeatures",
+	"timestamp_auth_key":    "string",
+	"upload_record_expiry":  "int",
+	"upload_recorder":       "Recorder",
+	"upload_source_id":      "string",
+	"upload_token":          "string",
+	"upload_token_func":     "UploadTokenFunc",
+	"upload_token_lifetime": "int",
+	"url_lifetime":          "int",
+	"verify_checksum":       "bool",
 	"work_dir":              "string",
+	"write_part_size":       "int64",
+	"write_rate_limit":      "int64",
 }
 var (
 	_ Servicer = &Service{}
@@ -153,15 +505,25 @@ type pairServiceNew struct {
 	pairs []Pair
 
 	// Required pairs
-	HasCredential bool
-	Credential    string
 	// Optional pairs
+	HasAPIEndpoint         bool
+	APIEndpoint            string
+	HasCredential          bool
+	Credential             string
 	HasDefaultServicePairs bool
 	DefaultServicePairs    DefaultServicePairs
 	HasEndpoint            bool
 	Endpoint               string
 	HasHTTPClientOptions   bool
 	HTTPClientOptions      *httpclient.Options
+	HasLogger              bool
+	Logger                 Logger
+	HasMetadataQPS         bool
+	MetadataQPS            int
+	HasRetryMaxAttempts    bool
+	RetryMaxAttempts       int
+	HasRetryMaxDelay       bool
+	RetryMaxDelay          int
 	HasServiceFeatures     bool
 	ServiceFeatures        ServiceFeatures
 }
@@ -175,13 +537,19 @@ func parsePairServiceNew(opts []Pair) (pairServiceNew, error) {
 	for _, v := range opts {
 		switch v.Key {
 		// Required pairs
+		// Optional pairs
+		case "api_endpoint":
+			if result.HasAPIEndpoint {
+				continue
+			}
+			result.HasAPIEndpoint = true
+			result.APIEndpoint = v.Value.(string)
 		case "credential":
 			if result.HasCredential {
 				continue
 			}
 			result.HasCredential = true
 			result.Credential = v.Value.(string)
-		// Optional pairs
 		case "default_service_pairs":
 			if result.HasDefaultServicePairs {
 				continue
@@ -200,6 +568,30 @@ func parsePairServiceNew(opts []Pair) (pairServiceNew, error) {
 			}
 			result.HasHTTPClientOptions = true
 			result.HTTPClientOptions = v.Value.(*httpclient.Options)
+		case "logger":
+			if result.HasLogger {
+				continue
+			}
+			result.HasLogger = true
+			result.Logger = v.Value.(Logger)
+		case "metadata_qps":
+			if result.HasMetadataQPS {
+				continue
+			}
+			result.HasMetadataQPS = true
+			result.MetadataQPS = v.Value.(int)
+		case "retry_max_attempts":
+			if result.HasRetryMaxAttempts {
+				continue
+			}
+			result.HasRetryMaxAttempts = true
+			result.RetryMaxAttempts = v.Value.(int)
+		case "retry_max_delay":
+			if result.HasRetryMaxDelay {
+				continue
+			}
+			result.HasRetryMaxDelay = true
+			result.RetryMaxDelay = v.Value.(int)
 		case "service_features":
 			if result.HasServiceFeatures {
 				continue
@@ -208,9 +600,6 @@ func parsePairServiceNew(opts []Pair) (pairServiceNew, error) {
 			result.ServiceFeatures = v.Value.(ServiceFeatures)
 		}
 	}
-	if !result.HasCredential {
-		return pairServiceNew{}, services.PairRequiredError{Keys: []string{"credential"}}
-	}
 
 	return result, nil
 }
@@ -448,17 +837,63 @@ type pairStorageNew struct {
 	pairs []Pair
 
 	// Required pairs
-	HasEndpoint bool
-	Endpoint    string
-	HasName     bool
-	Name        string
+	HasName bool
+	Name    string
 	// Optional pairs
+	HasClockSkew           bool
+	ClockSkew              int
+	HasDataQPS             bool
+	DataQPS                int
 	HasDefaultStoragePairs bool
 	DefaultStoragePairs    DefaultStoragePairs
+	HasDetectClockSkew     bool
+	DetectClockSkew        bool
+	HasEndpoint            bool
+	Endpoint               string
+	HasEndpointCooldown    bool
+	EndpointCooldown       int
+	HasEndpoints           bool
+	Endpoints              []string
+	HasMetadataQPS         bool
+	MetadataQPS            int
+	HasObserver            bool
+	Observer               Observer
+	HasPutPolicy           bool
+	PutPolicy              PutPolicy
+	HasReadConcurrency     bool
+	ReadConcurrency        int
+	HasReadPartSize        bool
+	ReadPartSize           int64
+	HasReadRateLimit       bool
+	ReadRateLimit          int64
+	HasReadResumeAttempts  bool
+	ReadResumeAttempts     int
+	HasRetryMaxAttempts    bool
+	RetryMaxAttempts       int
+	HasRetryMaxDelay       bool
+	RetryMaxDelay          int
 	HasStorageFeatures     bool
 	StorageFeatures        StorageFeatures
+	HasTimestampAuthKey    bool
+	TimestampAuthKey       string
+	HasUploadRecordExpiry  bool
+	UploadRecordExpiry     int
+	HasUploadRecorder      bool
+	UploadRecorder         Recorder
+	HasUploadToken         bool
+	UploadToken            string
+	HasUploadTokenFunc     bool
+	UploadTokenFunc        UploadTokenFunc
+	HasUploadTokenLifetime bool
+	UploadTokenLifetime    int
+	HasURLLifetime         bool
+	URLLifetime            int
 	HasWorkDir             bool
 	WorkDir                string
+	HasWritePartSize       bool
+	WritePartSize          int64
+	HasWriteRateLimit      bool
+	WriteRateLimit         int64
 }
 
 // parsePairStorageNew will parse Pair slice into *pairStorageNew
@@ -470,12 +905,6 @@ func parsePairStorageNew(opts []Pair) (pairStorageNew, error) {
 	for _, v := range opts {
 		switch v.Key {
 		// Required pairs
-		case "endpoint":
-			if result.HasEndpoint {
-				continue
-			}
-			result.HasEndpoint = true
-			result.Endpoint = v.Value.(string)
 		case "name":
 			if result.HasName {
 				continue
@@ -483,29 +912,170 @@ func parsePairStorageNew(opts []Pair) (pairStorageNew, error) {
 			result.HasName = true
 			result.Name = v.Value.(string)
 		// Optional pairs
+		case "clock_skew":
+			if result.HasClockSkew {
+				continue
+			}
+			result.HasClockSkew = true
+			result.ClockSkew = v.Value.(int)
+		case "data_qps":
+			if result.HasDataQPS {
+				continue
+			}
+			result.HasDataQPS = true
+			result.DataQPS = v.Value.(int)
 		case "default_storage_pairs":
 			if result.HasDefaultStoragePairs {
 				continue
 			}
 			result.HasDefaultStoragePairs = true
 			result.DefaultStoragePairs = v.Value.(DefaultStoragePairs)
+		case "detect_clock_skew":
+			if result.HasDetectClockSkew {
+				continue
+			}
+			result.HasDetectClockSkew = true
+			result.DetectClockSkew = v.Value.(bool)
+		case "endpoint":
+			if result.HasEndpoint {
+				continue
+			}
+			result.HasEndpoint = true
+			result.Endpoint = v.Value.(string)
+		case "endpoint_cooldown":
+			if result.HasEndpointCooldown {
+				continue
+			}
+			result.HasEndpointCooldown = true
+			result.EndpointCooldown = v.Value.(int)
+		case "endpoints":
+			if result.HasEndpoints {
+				continue
+			}
+			result.HasEndpoints = true
+			result.Endpoints = v.Value.([]string)
+		case "metadata_qps":
+			if result.HasMetadataQPS {
+				continue
+			}
+			result.HasMetadataQPS = true
+			result.MetadataQPS = v.Value.(int)
+		case "observer":
+			if result.HasObserver {
+				continue
+			}
+			result.HasObserver = true
+			result.Observer = v.Value.(Observer)
+		case "put_policy":
+			if result.HasPutPolicy {
+				continue
+			}
+			result.HasPutPolicy = true
+			result.PutPolicy = v.Value.(PutPolicy)
+		case "read_concurrency":
+			if result.HasReadConcurrency {
+				continue
+			}
+			result.HasReadConcurrency = true
+			result.ReadConcurrency = v.Value.(int)
+		case "read_part_size":
+			if result.HasReadPartSize {
+				continue
+			}
+			result.HasReadPartSize = true
+			result.ReadPartSize = v.Value.(int64)
+		case "read_rate_limit":
+			if result.HasReadRateLimit {
+				continue
+			}
+			result.HasReadRateLimit = true
+			result.ReadRateLimit = v.Value.(int64)
+		case "read_resume_attempts":
+			if result.HasReadResumeAttempts {
+				continue
+			}
+			result.HasReadResumeAttempts = true
+			result.ReadResumeAttempts = v.Value.(int)
+		case "retry_max_attempts":
+			if result.HasRetryMaxAttempts {
+				continue
+			}
+			result.HasRetryMaxAttempts = true
+			result.RetryMaxAttempts = v.Value.(int)
+		case "retry_max_delay":
+			if result.HasRetryMaxDelay {
+				continue
+			}
+			result.HasRetryMaxDelay = true
+			result.RetryMaxDelay = v.Value.(int)
 		case "storage_features":
 			if result.HasStorageFeatures {
 				continue
 			}
 			result.HasStorageFeatures = true
 			result.StorageFeatures = v.Value.(StorageFeatures)
+		case "timestamp_auth_key":
+			if result.HasTimestampAuthKey {
+				continue
+			}
+			result.HasTimestampAuthKey = true
+			result.TimestampAuthKey = v.Value.(string)
+		case "upload_record_expiry":
+			if result.HasUploadRecordExpiry {
+				continue
+			}
+			result.HasUploadRecordExpiry = true
+			result.UploadRecordExpiry = v.Value.(int)
+		case "upload_recorder":
+			if result.HasUploadRecorder {
+				continue
+			}
+			result.HasUploadRecorder = true
+			result.UploadRecorder = v.Value.(Recorder)
+		case "upload_token":
+			if result.HasUploadToken {
+				continue
+			}
+			result.HasUploadToken = true
+			result.UploadToken = v.Value.(string)
+		case "upload_token_func":
+			if result.HasUploadTokenFunc {
+				continue
+			}
+			result.HasUploadTokenFunc = true
+			result.UploadTokenFunc = v.Value.(UploadTokenFunc)
+		case "upload_token_lifetime":
+			if result.HasUploadTokenLifetime {
+				continue
+			}
+			result.HasUploadTokenLifetime = true
+			result.UploadTokenLifetime = v.Value.(int)
+		case "url_lifetime":
+			if result.HasURLLifetime {
+				continue
+			}
+			result.HasURLLifetime = true
+			result.URLLifetime = v.Value.(int)
 		case "work_dir":
 			if result.HasWorkDir {
 				continue
 			}
 			result.HasWorkDir = true
 			result.WorkDir = v.Value.(string)
+		case "write_part_size":
+			if result.HasWritePartSize {
+				continue
+			}
+			result.HasWritePartSize = true
+			result.WritePartSize = v.Value.(int64)
+		case "write_rate_limit":
+			if result.HasWriteRateLimit {
+				continue
+			}
+			result.HasWriteRateLimit = true
+			result.WriteRateLimit = v.Value.(int64)
 		}
 	}
-	if !result.HasEndpoint {
-		return pairStorageNew{}, services.PairRequiredError{Keys: []string{"endpoint"}}
-	}
 	if !result.HasName {
 		return pairStorageNew{}, services.PairRequiredError{Keys: []string{"name"}}
 	}
@@ -669,13 +1239,27 @@ func (s *Storage) parsePairStorageMetadata(opts []Pair) (pairStorageMetadata, er
 
 // pairStorageRead is the parsed struct
 type pairStorageRead struct {
-	pairs         []Pair
-	HasIoCallback bool
-	IoCallback    func([]byte)
-	HasOffset     bool
-	Offset        int64
-	HasSize       bool
-	Size          int64
+	pairs                 []Pair
+	HasIoCallback         bool
+	IoCallback            func([]byte)
+	HasOffset             bool
+	Offset                int64
+	HasRateLimit          bool
+	RateLimit             int64
+	HasReadConcurrency    bool
+	ReadConcurrency       int
+	HasReadPartSize       bool
+	ReadPartSize          int64
+	HasReadResult         bool
+	ReadResult            *ReadResult
+	HasReadResumeAttempts bool
+	ReadResumeAttempts    int
+	HasSize               bool
+	Size                  int64
+	HasURLLifetime        bool
+	URLLifetime           int
+	HasVerifyChecksum     bool
+	VerifyChecksum        bool
 }
 
 // parsePairStorageRead will parse Pair slice into *pairStorageRead
@@ -700,6 +1284,41 @@ func (s *Storage) parsePairStorageRead(opts []Pair) (pairStorageRead, error) {
 			result.HasOffset = true
 			result.Offset = v.Value.(int64)
 			continue
+		case "rate_limit":
+			if result.HasRateLimit {
+				continue
+			}
+			result.HasRateLimit = true
+			result.RateLimit = v.Value.(int64)
+			continue
+		case "read_concurrency":
+			if result.HasReadConcurrency {
+				continue
+			}
+			result.HasReadConcurrency = true
+			result.ReadConcurrency = v.Value.(int)
+			continue
+		case "read_part_size":
+			if result.HasReadPartSize {
+				continue
+			}
+			result.HasReadPartSize = true
+			result.ReadPartSize = v.Value.(int64)
+			continue
+		case "read_result":
+			if result.HasReadResult {
+				continue
+			}
+			result.HasReadResult = true
+			result.ReadResult = v.Value.(*ReadResult)
+			continue
+		case "read_resume_attempts":
+			if result.HasReadResumeAttempts {
+				continue
+			}
+			result.HasReadResumeAttempts = true
+			result.ReadResumeAttempts = v.Value.(int)
+			continue
 		case "size":
 			if result.HasSize {
 				continue
@@ -707,6 +1326,20 @@ func (s *Storage) parsePairStorageRead(opts []Pair) (pairStorageRead, error) {
 			result.HasSize = true
 			result.Size = v.Value.(int64)
 			continue
+		case "url_lifetime":
+			if result.HasURLLifetime {
+				continue
+			}
+			result.HasURLLifetime = true
+			result.URLLifetime = v.Value.(int)
+			continue
+		case "verify_checksum":
+			if result.HasVerifyChecksum {
+				continue
+			}
+			result.HasVerifyChecksum = true
+			result.VerifyChecksum = v.Value.(bool)
+			continue
 		default:
 			return pairStorageRead{}, services.PairUnsupportedError{Pair: v}
 		}
@@ -751,15 +1384,29 @@ func (s *Storage) parsePairStorageStat(opts []Pair) (pairStorageStat, error) {
 
 // pairStorageWrite is the parsed struct
 type pairStorageWrite struct {
-	pairs           []Pair
-	HasContentMd5   bool
-	ContentMd5      string
-	HasContentType  bool
-	ContentType     string
-	HasIoCallback   bool
-	IoCallback      func([]byte)
-	HasStorageClass bool
-	StorageClass    int
+	pairs             []Pair
+	HasContentCrc32   bool
+	ContentCrc32      uint32
+	HasContentMd5     bool
+	ContentMd5        string
+	HasContentType    bool
+	ContentType       string
+	HasIoCallback     bool
+	IoCallback        func([]byte)
+	HasPutPolicy      bool
+	PutPolicy         PutPolicy
+	HasPutResult      bool
+	PutResult         *PutResult
+	HasRateLimit      bool
+	RateLimit         int64
+	HasSkipUnchanged  bool
+	SkipUnchanged     bool
+	HasStorageClass   bool
+	StorageClass      int
+	HasUploadSourceID bool
+	UploadSourceID    string
+	HasWritePartSize  bool
+	WritePartSize     int64
 }
 
 // parsePairStorageWrite will parse Pair slice into *pairStorageWrite
@@ -770,6 +1417,13 @@ func (s *Storage) parsePairStorageWrite(opts []Pair) (pairStorageWrite, error) {
 
 	for _, v := range opts {
 		switch v.Key {
+		case "content_crc32":
+			if result.HasContentCrc32 {
+				continue
+			}
+			result.HasContentCrc32 = true
+			result.ContentCrc32 = v.Value.(uint32)
+			continue
 		case "content_md5":
 			if result.HasContentMd5 {
 				continue
@@ -791,6 +1445,34 @@ func (s *Storage) parsePairStorageWrite(opts []Pair) (pairStorageWrite, error) {
 			result.HasIoCallback = true
 			result.IoCallback = v.Value.(func([]byte))
 			continue
+		case "put_policy":
+			if result.HasPutPolicy {
+				continue
+			}
+			result.HasPutPolicy = true
+			result.PutPolicy = v.Value.(PutPolicy)
+			continue
+		case "put_result":
+			if result.HasPutResult {
+				continue
+			}
+			result.HasPutResult = true
+			result.PutResult = v.Value.(*PutResult)
+			continue
+		case "rate_limit":
+			if result.HasRateLimit {
+				continue
+			}
+			result.HasRateLimit = true
+			result.RateLimit = v.Value.(int64)
+			continue
+		case "skip_unchanged":
+			if result.HasSkipUnchanged {
+				continue
+			}
+			result.HasSkipUnchanged = true
+			result.SkipUnchanged = v.Value.(bool)
+			continue
 		case "storage_class":
 			if result.HasStorageClass {
 				continue
@@ -798,6 +1480,20 @@ func (s *Storage) parsePairStorageWrite(opts []Pair) (pairStorageWrite, error) {
 			result.HasStorageClass = true
 			result.StorageClass = v.Value.(int)
 			continue
+		case "upload_source_id":
+			if result.HasUploadSourceID {
+				continue
+			}
+			result.HasUploadSourceID = true
+			result.UploadSourceID = v.Value.(string)
+			continue
+		case "write_part_size":
+			if result.HasWritePartSize {
+				continue
+			}
+			result.HasWritePartSize = true
+			result.WritePartSize = v.Value.(int64)
+			continue
 		default:
 			return pairStorageWrite{}, services.PairUnsupportedError{Pair: v}
 		}
@@ -0,0 +1,752 @@
+/*
+Package kodotest provides an in-process fake kodo server for offline testing.
+
+The fake serves up, rs, rsf, io and uc apis on the same host and keeps all
+objects in memory, so that a storager could be tested without credentials:
+
+	srv := kodotest.NewServer("bucket")
+	defer srv.Close()
+
+	store, err := kodo.NewStorager(
+		ps.WithCredential(srv.Credential()),
+		ps.WithName("bucket"),
+		ps.WithEndpoint(srv.Endpoint()),
+		kodo.WithAPIEndpoint(srv.Endpoint()),
+	)
+*/
+package kodotest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/go-sdk/v7/auth"
+	"github.com/qiniu/go-sdk/v7/auth/qbox"
+)
+
+// Default credential accepted by the fake server.
+const (
+	AccessKey = "kodotest-access-key"
+	SecretKey = "kodotest-secret-key"
+)
+
+// Error code returned by the fake server, they are the same as kodo.
+//
+// ref: https://developer.qiniu.com/kodo/api/3928/error-responses
+const (
+	codeBadRequest       = 400
+	codeBadToken         = 401
+	codeNotFound         = 404
+	codeCrc32Mismatch    = 406
+	codeFileNotExist     = 612
+	codeFileExists       = 614
+	codeCallbackFailed   = 579
+	codeBucketNotExist   = 631
+	codeInvalidBlockCtx  = 701
+	defaultBlockLifetime = 7 * 24 * time.Hour
+)
+
+// Server is an in-process fake kodo server.
+type Server struct {
+	*httptest.Server
+
+	// Bucket is the bucket served by the download domain.
+	Bucket string
+
+	mac *auth.Credentials
+	seq int64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	blocks  map[string]*block
+	uploads map[string]*multipartUpload
+	fault   func(r *http.Request) int
+	skew    time.Duration
+	cut     func(r *http.Request) int64
+
+	timestampAuthKey string
+}
+
+type bucket struct {
+	private bool
+	objects map[string]*object
+}
+
+type object struct {
+	data     []byte
+	hash     string
+	mimeType string
+	putTime  int64
+	fileType int
+}
+
+type block struct {
+	data      []byte
+	expiredAt int64
+}
+
+type multipartUpload struct {
+	bucket string
+	key    string
+	hasKey bool
+	policy *putPolicy
+	parts  map[int64][]byte
+}
+
+// NewServer will start a fake kodo server with a private bucket which is
+// served by its download domain.
+func NewServer(name string) *Server {
+	s := &Server{
+		Bucket:  name,
+		mac:     qbox.NewMac(AccessKey, SecretKey),
+		buckets: make(map[string]*bucket),
+		blocks:  make(map[string]*block),
+		uploads: make(map[string]*multipartUpload),
+	}
+	s.CreateBucket(name)
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Credential returns the credential accepted by the server.
+func (s *Server) Credential() string {
+	return fmt.Sprintf("hmac:%s:%s", AccessKey, SecretKey)
+}
+
+// Endpoint returns the endpoint of the server, which could be used as both
+// download domain and api endpoint.
+func (s *Server) Endpoint() string {
+	return "http:" + strings.TrimPrefix(s.URL, "http://")
+}
+
+// CreateBucket will create a private bucket if not exist.
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[name]; !ok {
+		s.buckets[name] = &bucket{private: true, objects: make(map[string]*object)}
+	}
+}
+
+// SetPrivate will change whether the bucket is private. Objects in public
+// bucket could be downloaded without token.
+func (s *Server) SetPrivate(bucket string, private bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		panic(fmt.Sprintf("bucket %s not exist", bucket))
+	}
+	b.private = private
+}
+
+// PutObject will put an object into bucket directly.
+func (s *Server) PutObject(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		panic(fmt.Sprintf("bucket %s not exist", bucket))
+	}
+	b.objects[key] = newObject(data, "")
+}
+
+// GetObject will get an object's content from bucket directly.
+func (s *Server) GetObject(bucket, key string) (data []byte, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, false
+	}
+	o, ok := b.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return o.data, true
+}
+
+// SetFault will set a function to inject failures. For every request, the
+// server responds with the returned code directly if it's not zero.
+func (s *Server) SetFault(fn func(r *http.Request) int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fault = fn
+}
+
+// SetInterrupt will set a function to interrupt downloads. For every
+// download, the connection is dropped after the returned bytes of body are
+// sent if it's positive.
+func (s *Server) SetInterrupt(fn func(r *http.Request) int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cut = fn
+}
+
+// SetTimestampAuthKey will make the download domain act as a cdn domain
+// protected by timestamp anti-leech, empty key disables it.
+func (s *Server) SetTimestampAuthKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timestampAuthKey = key
+}
+
+// SetClockSkew will make the server clock differ from local clock, which
+// affects the Date header and the deadline check of download urls.
+func (s *Server) SetClockSkew(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.skew = d
+}
+
+func (s *Server) now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return time.Now().Add(s.skew)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Reqid", fmt.Sprintf("kodotest-%d", atomic.AddInt64(&s.seq, 1)))
+	w.Header().Set("X-Log", "kodotest")
+	w.Header().Set("Date", s.now().UTC().Format(http.TimeFormat))
+
+	s.mu.Lock()
+	fault := s.fault
+	s.mu.Unlock()
+	if fault != nil {
+		if code := fault(r); code != 0 {
+			writeError(w, code, "injected fault")
+			return
+		}
+	}
+
+	p := r.URL.Path
+	switch {
+	case r.Method == http.MethodGet && p == "/v2/query":
+		s.handleQuery(w, r)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.handleDownload(w, r)
+	case r.Method == http.MethodPost && p == "/":
+		s.handleFormUpload(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(p, "/mkblk/"):
+		s.handleMkblk(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(p, "/bput/"):
+		s.handleBput(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(p, "/mkfile/"):
+		s.handleMkfile(w, r)
+	case strings.HasPrefix(p, "/buckets/"):
+		s.handleMultipart(w, r)
+	case r.Method == http.MethodPost && p == "/buckets":
+		s.handleBuckets(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(p, "/mkbucketv3/"):
+		s.handleMkbucket(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(p, "/drop/"):
+		s.handleDrop(w, r)
+	case r.Method == http.MethodPost && p == "/list":
+		s.handleList(w, r)
+	case r.Method == http.MethodPost && p == "/batch":
+		s.handleBatch(w, r)
+	case r.Method == http.MethodPost:
+		s.handleRs(w, r)
+	default:
+		writeError(w, codeBadRequest, "unsupported request")
+	}
+}
+
+// checkManageToken verifies the qiniu management token in Authorization header.
+func (s *Server) checkManageToken(w http.ResponseWriter, r *http.Request) bool {
+	v := r.Header.Get("Authorization")
+	var expected string
+	var err error
+	switch {
+	case strings.HasPrefix(v, "Qiniu "):
+		v = strings.TrimPrefix(v, "Qiniu ")
+		expected, err = s.mac.SignRequestV2(r)
+	case strings.HasPrefix(v, "QBox "):
+		v = strings.TrimPrefix(v, "QBox ")
+		expected, err = s.mac.SignRequest(r)
+	default:
+		writeError(w, codeBadToken, "bad token")
+		return false
+	}
+	if err != nil || v != expected {
+		writeError(w, codeBadToken, "bad token")
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	domains := map[string]interface{}{
+		"main": []string{host},
+	}
+	writeJSON(w, map[string]interface{}{
+		"ttl": 86400,
+		"io":  map[string]interface{}{"src": domains},
+		"up": map[string]interface{}{
+			"src": domains,
+			"acc": domains,
+		},
+	})
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+
+	s.mu.Lock()
+	b, ok := s.buckets[s.Bucket]
+	var o *object
+	if ok {
+		o, ok = b.objects[key]
+	}
+	private := b != nil && b.private
+	authKey := s.timestampAuthKey
+	s.mu.Unlock()
+
+	switch {
+	case authKey != "":
+		// Download domain acts as a cdn domain, which fetches from private
+		// bucket by itself.
+		if !s.checkTimestampURL(w, r, authKey) {
+			return
+		}
+	case private:
+		if !s.checkPrivateURL(w, r) {
+			return
+		}
+	}
+	if !ok {
+		writeError(w, codeNotFound, "Document not found")
+		return
+	}
+
+	s.mu.Lock()
+	cut := s.cut
+	s.mu.Unlock()
+	if cut != nil {
+		if n := cut(r); n > 0 {
+			w = &interruptWriter{ResponseWriter: w, remaining: n}
+		}
+	}
+
+	w.Header().Set("ETag", strconv.Quote(o.hash))
+	w.Header().Set("Content-Type", o.mimeType)
+	http.ServeContent(w, r, "", time.Unix(0, o.putTime*100), bytes.NewReader(o.data))
+}
+
+// checkTimestampURL verifies url signed by cdn timestamp anti-leech key.
+//
+// ref: https://developer.qiniu.com/fusion/kb/1670/timestamp-hotlinking-prevention
+func (s *Server) checkTimestampURL(w http.ResponseWriter, r *http.Request, key string) bool {
+	q := r.URL.Query()
+	t := q.Get("t")
+	sum := md5.Sum([]byte(key + r.URL.EscapedPath() + t))
+	if q.Get("sign") != hex.EncodeToString(sum[:]) {
+		writeError(w, http.StatusForbidden, "invalid sign")
+		return false
+	}
+
+	deadline, err := strconv.ParseInt(t, 16, 64)
+	if err != nil || deadline < s.now().Unix() {
+		writeError(w, http.StatusForbidden, "url expired")
+		return false
+	}
+	return true
+}
+
+// checkPrivateURL verifies url generated by MakePrivateURL.
+//
+// ref: https://developer.qiniu.com/kodo/1202/download-token
+func (s *Server) checkPrivateURL(w http.ResponseWriter, r *http.Request) bool {
+	uri := r.RequestURI
+	idx := strings.LastIndex(uri, "&token=")
+	if idx < 0 {
+		writeError(w, codeBadToken, "bad token")
+		return false
+	}
+	signed, token := uri[:idx], uri[idx+len("&token="):]
+	if s.mac.Sign([]byte("http://"+r.Host+signed)) != token {
+		writeError(w, codeBadToken, "bad token")
+		return false
+	}
+
+	e, err := strconv.ParseInt(r.URL.Query().Get("e"), 10, 64)
+	if err != nil || e < s.now().Unix() {
+		writeError(w, codeBadToken, "token out of date")
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	if !s.checkManageToken(w, r) {
+		return
+	}
+
+	s.mu.Lock()
+	names := make([]string, 0, len(s.buckets))
+	for k := range s.buckets {
+		names = append(names, k)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(names)
+	writeJSON(w, names)
+}
+
+func (s *Server) handleMkbucket(w http.ResponseWriter, r *http.Request) {
+	if !s.checkManageToken(w, r) {
+		return
+	}
+
+	// path looks like: /mkbucketv3/<bucket>/region/<region>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[2] != "region" {
+		writeError(w, codeBadRequest, "invalid arguments")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[parts[1]]; ok {
+		writeError(w, codeFileExists, "the bucket already exists and you own it.")
+		return
+	}
+	s.buckets[parts[1]] = &bucket{private: true, objects: make(map[string]*object)}
+	writeJSON(w, nil)
+}
+
+func (s *Server) handleDrop(w http.ResponseWriter, r *http.Request) {
+	if !s.checkManageToken(w, r) {
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/drop/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[name]; !ok {
+		writeError(w, codeBucketNotExist, "no such bucket")
+		return
+	}
+	delete(s.buckets, name)
+	writeJSON(w, nil)
+}
+
+type listItem struct {
+	Key      string `json:"key"`
+	Hash     string `json:"hash"`
+	Fsize    int64  `json:"fsize"`
+	PutTime  int64  `json:"putTime"`
+	MimeType string `json:"mimeType"`
+	Type     int    `json:"type"`
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if !s.checkManageToken(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	var after string
+	if v := q.Get("marker"); v != "" {
+		bs, err := base64.URLEncoding.DecodeString(v)
+		if err != nil {
+			writeError(w, codeBadRequest, "invalid marker")
+			return
+		}
+		after = string(bs)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[q.Get("bucket")]
+	if !ok {
+		writeError(w, codeBucketNotExist, "no such bucket")
+		return
+	}
+
+	keys := make([]string, 0, len(b.objects))
+	for k := range b.objects {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	ret := struct {
+		Marker         string     `json:"marker,omitempty"`
+		Items          []listItem `json:"items"`
+		CommonPrefixes []string   `json:"commonPrefixes,omitempty"`
+	}{Items: []listItem{}}
+
+	count, last := 0, ""
+	for i, k := range keys {
+		if count >= limit {
+			ret.Marker = base64.URLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		last = k
+
+		if delimiter != "" {
+			if idx := strings.Index(k[len(prefix):], delimiter); idx >= 0 {
+				cp := k[:len(prefix)+idx+len(delimiter)]
+				n := len(ret.CommonPrefixes)
+				if n > 0 && ret.CommonPrefixes[n-1] == cp {
+					continue
+				}
+				ret.CommonPrefixes = append(ret.CommonPrefixes, cp)
+				count++
+				// Skip all keys under this common prefix.
+				for i+1 < len(keys) && strings.HasPrefix(keys[i+1], cp) {
+					i++
+				}
+				continue
+			}
+		}
+
+		o := b.objects[k]
+		ret.Items = append(ret.Items, o.listItem(k))
+		count++
+	}
+	writeJSON(w, ret)
+}
+
+func (s *Server) handleRs(w http.ResponseWriter, r *http.Request) {
+	if !s.checkManageToken(w, r) {
+		return
+	}
+
+	s.mu.Lock()
+	code, data := s.rsOp(r.URL.Path)
+	s.mu.Unlock()
+
+	if code != http.StatusOK {
+		writeError(w, code, data.(string))
+		return
+	}
+	writeJSON(w, data)
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if !s.checkManageToken(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, codeBadRequest, err.Error())
+		return
+	}
+
+	type result struct {
+		Code int         `json:"code"`
+		Data interface{} `json:"data,omitempty"`
+	}
+
+	s.mu.Lock()
+	rets := make([]result, 0, len(r.PostForm["op"]))
+	for _, op := range r.PostForm["op"] {
+		code, data := s.rsOp(op)
+		if code != http.StatusOK {
+			data = map[string]string{"error": data.(string)}
+		}
+		rets = append(rets, result{Code: code, Data: data})
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, rets)
+}
+
+// rsOp will execute a rs operation, the caller must hold the lock.
+//
+// For failed operation, data will be the error message.
+func (s *Server) rsOp(op string) (code int, data interface{}) {
+	parts := strings.Split(strings.TrimPrefix(op, "/"), "/")
+	if len(parts) < 2 {
+		return codeBadRequest, "invalid arguments"
+	}
+
+	b, key, code, msg := s.lookupEntry(parts[1])
+	if code != 0 {
+		return code, msg
+	}
+	o, exist := b.objects[key]
+
+	switch parts[0] {
+	case "stat":
+		if !exist {
+			return codeFileNotExist, "no such file or directory"
+		}
+		return http.StatusOK, o.listItem(key)
+	case "delete":
+		if !exist {
+			return codeFileNotExist, "no such file or directory"
+		}
+		delete(b.objects, key)
+		return http.StatusOK, nil
+	case "copy", "move":
+		if !exist {
+			return codeFileNotExist, "no such file or directory"
+		}
+		if len(parts) < 3 {
+			return codeBadRequest, "invalid arguments"
+		}
+		db, dkey, code, msg := s.lookupEntry(parts[2])
+		if code != 0 {
+			return code, msg
+		}
+		force := len(parts) >= 5 && parts[3] == "force" && parts[4] == "true"
+		if _, ok := db.objects[dkey]; ok && !force {
+			return codeFileExists, "file exists"
+		}
+		no := *o
+		db.objects[dkey] = &no
+		if parts[0] == "move" && (db != b || dkey != key) {
+			delete(b.objects, key)
+		}
+		return http.StatusOK, nil
+	case "chgm":
+		if !exist {
+			return codeFileNotExist, "no such file or directory"
+		}
+		if len(parts) < 4 || parts[2] != "mime" {
+			return codeBadRequest, "invalid arguments"
+		}
+		mime, err := base64.URLEncoding.DecodeString(parts[3])
+		if err != nil {
+			return codeBadRequest, "invalid arguments"
+		}
+		o.mimeType = string(mime)
+		return http.StatusOK, nil
+	case "chtype":
+		if !exist {
+			return codeFileNotExist, "no such file or directory"
+		}
+		if len(parts) < 4 || parts[2] != "type" {
+			return codeBadRequest, "invalid arguments"
+		}
+		t, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return codeBadRequest, "invalid arguments"
+		}
+		o.fileType = t
+		return http.StatusOK, nil
+	default:
+		return codeBadRequest, "unsupported operation"
+	}
+}
+
+// lookupEntry decodes an encoded entry, the caller must hold the lock.
+func (s *Server) lookupEntry(entry string) (b *bucket, key string, code int, msg string) {
+	bs, err := base64.URLEncoding.DecodeString(entry)
+	if err != nil {
+		return nil, "", codeBadRequest, "invalid encoded entry"
+	}
+	idx := strings.Index(string(bs), ":")
+	if idx < 0 {
+		return nil, "", codeBadRequest, "invalid encoded entry"
+	}
+
+	b, ok := s.buckets[string(bs[:idx])]
+	if !ok {
+		return nil, "", codeBucketNotExist, "no such bucket"
+	}
+	return b, string(bs[idx+1:]), 0, ""
+}
+
+func newObject(data []byte, mimeType string) *object {
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return &object{
+		data:     data,
+		hash:     etag(data),
+		mimeType: mimeType,
+		// putTime returned by kodo is in 100 nanoseconds.
+		putTime: time.Now().UnixNano() / 100,
+	}
+}
+
+func (o *object) listItem(key string) listItem {
+	return listItem{
+		Key:      key,
+		Hash:     o.hash,
+		Fsize:    int64(len(o.data)),
+		PutTime:  o.putTime,
+		MimeType: o.mimeType,
+		Type:     o.fileType,
+	}
+}
+
+// interruptWriter drops the connection after remaining bytes are written.
+type interruptWriter struct {
+	http.ResponseWriter
+	remaining int64
+}
+
+func (w *interruptWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) < w.remaining {
+		w.remaining -= int64(len(p))
+		return w.ResponseWriter.Write(p)
+	}
+
+	_, _ = w.ResponseWriter.Write(p[:w.remaining])
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	panic(http.ErrAbortHandler)
+}
+
+func newID() string {
+	bs := make([]byte, 16)
+	_, _ = rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if v == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	bs, _ := json.Marshal(v)
+	w.Header().Set("Content-Length", strconv.Itoa(len(bs)))
+	_, _ = w.Write(bs)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	bs, _ := json.Marshal(map[string]string{"error": msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(bs)))
+	w.WriteHeader(code)
+	_, _ = w.Write(bs)
+}
@@ -0,0 +1,593 @@
+package kodotest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// putPolicy contains the fields of upload policy supported by the fake server.
+//
+// ref: https://developer.qiniu.com/kodo/1206/put-policy
+type putPolicy struct {
+	Scope      string `json:"scope"`
+	Deadline   int64  `json:"deadline"`
+	InsertOnly uint16 `json:"insertOnly,omitempty"`
+	FsizeMin   int64  `json:"fsizeMin,omitempty"`
+	FsizeLimit int64  `json:"fsizeLimit,omitempty"`
+	MimeLimit  string `json:"mimeLimit,omitempty"`
+	ReturnBody string `json:"returnBody,omitempty"`
+	FileType   int    `json:"fileType,omitempty"`
+
+	CallbackURL      string `json:"callbackUrl,omitempty"`
+	CallbackHost     string `json:"callbackHost,omitempty"`
+	CallbackBody     string `json:"callbackBody,omitempty"`
+	CallbackBodyType string `json:"callbackBodyType,omitempty"`
+
+	bucket string
+	key    string
+}
+
+// checkUploadToken verifies the upload token and returns the policy in it.
+//
+// ref: https://developer.qiniu.com/kodo/1208/upload-token
+func (s *Server) checkUploadToken(w http.ResponseWriter, token string) (*putPolicy, bool) {
+	parts := strings.Split(token, ":")
+	if len(parts) != 3 || parts[0] != AccessKey || s.mac.Sign([]byte(parts[2])) != parts[0]+":"+parts[1] {
+		writeError(w, codeBadToken, "bad token")
+		return nil, false
+	}
+
+	bs, err := base64.URLEncoding.DecodeString(parts[2])
+	if err != nil {
+		writeError(w, codeBadToken, "bad token")
+		return nil, false
+	}
+	p := &putPolicy{}
+	if err = json.Unmarshal(bs, p); err != nil {
+		writeError(w, codeBadToken, "bad token")
+		return nil, false
+	}
+	if p.Deadline < time.Now().Unix() {
+		writeError(w, codeBadToken, "token out of date")
+		return nil, false
+	}
+
+	idx := strings.Index(p.Scope, ":")
+	if idx < 0 {
+		p.bucket = p.Scope
+	} else {
+		p.bucket, p.key = p.Scope[:idx], p.Scope[idx+1:]
+	}
+	return p, true
+}
+
+// checkHeaderToken verifies the upload token in Authorization header.
+func (s *Server) checkHeaderToken(w http.ResponseWriter, r *http.Request) (*putPolicy, bool) {
+	v := r.Header.Get("Authorization")
+	if !strings.HasPrefix(v, "UpToken ") {
+		writeError(w, codeBadToken, "bad token")
+		return nil, false
+	}
+	return s.checkUploadToken(w, strings.TrimPrefix(v, "UpToken "))
+}
+
+// putFile will save data as key under the policy, hash is the qetag of data
+// if it's empty. The caller must not hold the lock.
+//
+// Like kodo, token of bucket scope could not overwrite an existing object
+// unless the content is the same.
+func (s *Server) putFile(w http.ResponseWriter, p *putPolicy, key string, hasKey bool, data []byte, hash, mimeType string) {
+	if !hasKey {
+		if p.key == "" {
+			key = etag(data)
+		} else {
+			key = p.key
+		}
+	}
+	if p.key != "" && p.key != key {
+		writeError(w, codeBadToken, "key doesn't match with scope")
+		return
+	}
+	size := int64(len(data))
+	if p.FsizeLimit > 0 && size > p.FsizeLimit {
+		writeError(w, 413, "request entity too large")
+		return
+	}
+	if size < p.FsizeMin {
+		writeError(w, 403, "file size is less than fsizeMin")
+		return
+	}
+	if p.MimeLimit != "" && !matchMime(p.MimeLimit, mimeType) {
+		writeError(w, 403, "limited mimeType: this file type is forbidden to upload")
+		return
+	}
+
+	o := newObject(data, mimeType)
+	if hash != "" {
+		o.hash = hash
+	}
+	o.fileType = p.FileType
+
+	s.mu.Lock()
+	b, ok := s.buckets[p.bucket]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, codeBucketNotExist, "no such bucket")
+		return
+	}
+	if old, exist := b.objects[key]; exist && (p.InsertOnly != 0 || p.key == "" && old.hash != o.hash) {
+		s.mu.Unlock()
+		writeError(w, codeFileExists, "file exists")
+		return
+	}
+	b.objects[key] = o
+	s.mu.Unlock()
+
+	vars := map[string]string{
+		"hash":     o.hash,
+		"etag":     o.hash,
+		"key":      key,
+		"fsize":    strconv.FormatInt(size, 10),
+		"mimeType": o.mimeType,
+		"bucket":   p.bucket,
+	}
+	switch {
+	case p.CallbackURL != "":
+		callback(w, p, vars)
+	case p.ReturnBody != "":
+		body := renderMagicVars(p.ReturnBody, vars, strconv.Quote)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	default:
+		writeJSON(w, map[string]interface{}{
+			"hash":     o.hash,
+			"key":      key,
+			"fsize":    size,
+			"mimeType": o.mimeType,
+			"bucket":   p.bucket,
+		})
+	}
+}
+
+// callback will POST callback body to the first callback url, and respond
+// with the callback response.
+//
+// ref: https://developer.qiniu.com/kodo/1206/put-policy#callback
+func callback(w http.ResponseWriter, p *putPolicy, vars map[string]string) {
+	bodyType := p.CallbackBodyType
+	escape := url.QueryEscape
+	if bodyType == "" {
+		bodyType = "application/x-www-form-urlencoded"
+	} else if bodyType == "application/json" {
+		escape = strconv.Quote
+	}
+	body := renderMagicVars(p.CallbackBody, vars, escape)
+
+	req, err := http.NewRequest(http.MethodPost, strings.Split(p.CallbackURL, ";")[0], strings.NewReader(body))
+	if err != nil {
+		writeError(w, codeCallbackFailed, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", bodyType)
+	if p.CallbackHost != "" {
+		req.Host = p.CallbackHost
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		writeError(w, codeCallbackFailed, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		writeError(w, codeCallbackFailed, fmt.Sprintf("callback failed with status %d", resp.StatusCode))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(content)
+}
+
+// renderMagicVars replaces magic variables like `$(key)` in tmpl.
+//
+// For JSON body, a magic variable which is the whole value of a string
+// like `"$(key)"` is replaced without escaping twice.
+func renderMagicVars(tmpl string, vars map[string]string, escape func(string) string) string {
+	for k, v := range vars {
+		ev := escape(v)
+		if strings.HasPrefix(ev, `"`) {
+			tmpl = strings.Replace(tmpl, `"$(`+k+`)"`, ev, -1)
+			ev = strings.Trim(ev, `"`)
+		}
+		tmpl = strings.Replace(tmpl, "$("+k+")", ev, -1)
+	}
+	return tmpl
+}
+
+func matchMime(limit, mimeType string) bool {
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	deny := strings.HasPrefix(limit, "!")
+	limit = strings.TrimPrefix(limit, "!")
+
+	matched := false
+	for _, v := range strings.Split(limit, ";") {
+		v = strings.TrimSpace(v)
+		if v == mimeType || (strings.HasSuffix(v, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(v, "*"))) {
+			matched = true
+			break
+		}
+	}
+	return matched != deny
+}
+
+// ref: https://developer.qiniu.com/kodo/1272/form-upload
+func (s *Server) handleFormUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, codeBadRequest, err.Error())
+		return
+	}
+	p, ok := s.checkUploadToken(w, r.FormValue("token"))
+	if !ok {
+		return
+	}
+
+	f, fh, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, codeBadRequest, "file is not specified in multipart")
+		return
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		writeError(w, codeBadRequest, err.Error())
+		return
+	}
+
+	if v := r.FormValue("crc32"); v != "" {
+		crc, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || uint32(crc) != crc32.ChecksumIEEE(data) {
+			writeError(w, codeCrc32Mismatch, "crc32 not match")
+			return
+		}
+	}
+
+	_, hasKey := r.MultipartForm.Value["key"]
+	s.putFile(w, p, r.FormValue("key"), hasKey, data, "", fh.Header.Get("Content-Type"))
+}
+
+// ref: https://developer.qiniu.com/kodo/1286/mkblk
+func (s *Server) handleMkblk(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.checkHeaderToken(w, r); !ok {
+		return
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/mkblk/"), 10, 64)
+	if err != nil || size <= 0 || size > 4<<20 {
+		writeError(w, codeBadRequest, "invalid block size")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, codeBadRequest, err.Error())
+		return
+	}
+
+	id := newID()
+	blk := &block{data: data, expiredAt: time.Now().Add(defaultBlockLifetime).Unix()}
+
+	s.mu.Lock()
+	s.blocks[id] = blk
+	s.mu.Unlock()
+
+	writeBlock(w, r, id, blk)
+}
+
+// ref: https://developer.qiniu.com/kodo/1251/bput
+func (s *Server) handleBput(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.checkHeaderToken(w, r); !ok {
+		return
+	}
+	// path looks like: /bput/<ctx>/<offset>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/bput/"), "/")
+	if len(parts) != 2 {
+		writeError(w, codeBadRequest, "invalid arguments")
+		return
+	}
+	offset, err := strconv.Atoi(parts[1])
+	if err != nil {
+		writeError(w, codeBadRequest, "invalid offset")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, codeBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	blk, ok := s.blocks[parts[0]]
+	if !ok || len(blk.data) != offset {
+		s.mu.Unlock()
+		writeError(w, codeInvalidBlockCtx, "invalid block ctx or offset")
+		return
+	}
+	blk.data = append(blk.data, data...)
+	s.mu.Unlock()
+
+	writeBlock(w, r, parts[0], blk)
+}
+
+func writeBlock(w http.ResponseWriter, r *http.Request, id string, blk *block) {
+	writeJSON(w, map[string]interface{}{
+		"ctx":        id,
+		"checksum":   hex.EncodeToString(sha1Sum(blk.data)),
+		"crc32":      crc32.ChecksumIEEE(blk.data),
+		"offset":     len(blk.data),
+		"host":       "http://" + r.Host,
+		"expired_at": blk.expiredAt,
+	})
+}
+
+// ref: https://developer.qiniu.com/kodo/1287/mkfile
+func (s *Server) handleMkfile(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.checkHeaderToken(w, r)
+	if !ok {
+		return
+	}
+
+	// path looks like: /mkfile/<size>/key/<encodedKey>/mimeType/<encodedMimeType>/x:user-var/<encodedValue>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/mkfile/"), "/")
+	size, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		writeError(w, codeBadRequest, "invalid file size")
+		return
+	}
+	var key, mimeType string
+	var hasKey bool
+	for i := 1; i+1 < len(parts); i += 2 {
+		v, err := base64.URLEncoding.DecodeString(parts[i+1])
+		if err != nil {
+			writeError(w, codeBadRequest, "invalid arguments")
+			return
+		}
+		switch parts[i] {
+		case "key":
+			key, hasKey = string(v), true
+		case "mimeType":
+			mimeType = string(v)
+		}
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, codeBadRequest, err.Error())
+		return
+	}
+
+	var data []byte
+	s.mu.Lock()
+	if len(body) > 0 {
+		for _, id := range strings.Split(string(body), ",") {
+			blk, ok := s.blocks[id]
+			if !ok {
+				s.mu.Unlock()
+				writeError(w, codeInvalidBlockCtx, "invalid block ctx")
+				return
+			}
+			data = append(data, blk.data...)
+		}
+	}
+	s.mu.Unlock()
+
+	if int64(len(data)) != size {
+		writeError(w, codeBadRequest, "file size not match")
+		return
+	}
+	s.putFile(w, p, key, hasKey, data, "", mimeType)
+}
+
+// handleMultipart serves multipart upload apis.
+//
+// ref: https://developer.qiniu.com/kodo/6364/multipartupload-interface
+func (s *Server) handleMultipart(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.checkHeaderToken(w, r)
+	if !ok {
+		return
+	}
+
+	// path looks like: /buckets/<bucket>/objects/<encodedKey>/uploads[/<uploadId>[/<partNumber>]]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/buckets/"), "/")
+	if len(parts) < 4 || parts[1] != "objects" || parts[3] != "uploads" {
+		writeError(w, codeBadRequest, "invalid arguments")
+		return
+	}
+	var key string
+	hasKey := parts[2] != "~"
+	if hasKey {
+		bs, err := base64.URLEncoding.DecodeString(parts[2])
+		if err != nil {
+			writeError(w, codeBadRequest, "invalid encoded key")
+			return
+		}
+		key = string(bs)
+	}
+
+	switch {
+	case len(parts) == 4 && r.Method == http.MethodPost:
+		id := newID()
+		s.mu.Lock()
+		s.uploads[id] = &multipartUpload{
+			bucket: parts[0],
+			key:    key,
+			hasKey: hasKey,
+			policy: p,
+			parts:  make(map[int64][]byte),
+		}
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{
+			"uploadId": id,
+			"expireAt": time.Now().Add(defaultBlockLifetime).Unix(),
+		})
+	case len(parts) == 5:
+		s.handleUpload(w, r, parts[4])
+	case len(parts) == 6 && r.Method == http.MethodPut:
+		s.handleUploadPart(w, r, parts[4], parts[5])
+	default:
+		writeError(w, codeBadRequest, "unsupported request")
+	}
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	u, ok := s.uploads[id]
+	if ok && r.Method == http.MethodDelete {
+		delete(s.uploads, id)
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, codeFileNotExist, "no such uploadId")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		writeJSON(w, nil)
+	case http.MethodPost:
+		var req struct {
+			Parts []struct {
+				PartNumber int64  `json:"partNumber"`
+				Etag       string `json:"etag"`
+			} `json:"parts"`
+			MimeType string `json:"mimeType"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, codeBadRequest, err.Error())
+			return
+		}
+		sort.Slice(req.Parts, func(i, j int) bool {
+			return req.Parts[i].PartNumber < req.Parts[j].PartNumber
+		})
+
+		var data []byte
+		var sizes []int
+		s.mu.Lock()
+		for _, v := range req.Parts {
+			part, ok := u.parts[v.PartNumber]
+			if !ok || md5Hex(part) != v.Etag {
+				s.mu.Unlock()
+				writeError(w, codeBadRequest, "invalid part")
+				return
+			}
+			data = append(data, part...)
+			sizes = append(sizes, len(part))
+		}
+		delete(s.uploads, id)
+		s.mu.Unlock()
+
+		s.putFile(w, u.policy, u.key, u.hasKey, data, partsEtag(data, sizes), req.MimeType)
+	default:
+		writeError(w, codeBadRequest, "unsupported request")
+	}
+}
+
+func (s *Server) handleUploadPart(w http.ResponseWriter, r *http.Request, id, partNumber string) {
+	n, err := strconv.ParseInt(partNumber, 10, 64)
+	if err != nil || n < 1 || n > 10000 {
+		writeError(w, codeBadRequest, "invalid part number")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, codeBadRequest, err.Error())
+		return
+	}
+	if v := r.Header.Get("Content-MD5"); v != "" && v != md5Hex(data) {
+		writeError(w, codeBadRequest, "content md5 not match")
+		return
+	}
+
+	s.mu.Lock()
+	u, ok := s.uploads[id]
+	if ok {
+		u.parts[n] = data
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, codeFileNotExist, "no such uploadId")
+		return
+	}
+
+	sum := md5Hex(data)
+	writeJSON(w, map[string]string{"etag": sum, "md5": sum})
+}
+
+// etag calculates the hash of data in the same way as kodo.
+//
+// ref: https://developer.qiniu.com/kodo/1231/appendix#qiniu-etag
+func etag(data []byte) string {
+	const blockSize = 4 << 20
+
+	var bs []byte
+	if len(data) <= blockSize {
+		bs = append([]byte{0x16}, sha1Sum(data)...)
+	} else {
+		var sums []byte
+		for i := 0; i < len(data); i += blockSize {
+			end := i + blockSize
+			if end > len(data) {
+				end = len(data)
+			}
+			sums = append(sums, sha1Sum(data[i:end])...)
+		}
+		bs = append([]byte{0x96}, sha1Sum(sums)...)
+	}
+	return base64.URLEncoding.EncodeToString(bs)
+}
+
+// partsEtag calculates the hash of data uploaded by parts of given sizes.
+//
+// It's the same as etag if all parts except the last one are of 4MB.
+// Otherwise, kodo responds an etag v2 which is not a qetag, and it's
+// mimicked by 0x9e followed by SHA1 of the concatenated SHA1 of parts.
+func partsEtag(data []byte, sizes []int) string {
+	const blockSize = 4 << 20
+
+	aligned := true
+	for i := 0; i+1 < len(sizes); i++ {
+		aligned = aligned && sizes[i] == blockSize
+	}
+	if aligned {
+		return etag(data)
+	}
+
+	var sums []byte
+	for _, size := range sizes {
+		sums = append(sums, sha1Sum(data[:size])...)
+		data = data[size:]
+	}
+	return base64.URLEncoding.EncodeToString(append([]byte{0x9e}, sha1Sum(sums)...))
+}
+
+func sha1Sum(data []byte) []byte {
+	sum := sha1.Sum(data)
+	return sum[:]
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,149 @@
+package kodo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket, which is safe for concurrent use.
+//
+// Tokens could be overdrawn, so that a large request never starves, and
+// later callers will wait until the debt is paid off. The bucket holds at
+// most one second of tokens.
+type rateLimiter struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a limiter of rate tokens per second.
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n tokens are allowed or ctx is done, and returns how
+// long it's delayed.
+func (l *rateLimiter) wait(ctx context.Context, n int) (time.Duration, error) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return 0, nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return delay, nil
+	case <-ctx.Done():
+		return time.Since(now), ctx.Err()
+	}
+}
+
+// limitCallback returns an io callback which blocks on limiters before
+// calling fn, limiters and fn could be nil.
+//
+// It's used with iowrap.CallbackReader and iowrap.CallbackWriter, so that
+// bytes are throttled where they are counted. Waiting stops once ctx is
+// done, and the operation will fail on the canceled ctx.
+func limitCallback(ctx context.Context, fn func([]byte), limiters ...*rateLimiter) func([]byte) {
+	var ls []*rateLimiter
+	for _, l := range limiters {
+		if l != nil {
+			ls = append(ls, l)
+		}
+	}
+	if len(ls) == 0 {
+		return fn
+	}
+
+	return func(p []byte) {
+		for _, l := range ls {
+			if _, err := l.wait(ctx, len(p)); err != nil {
+				break
+			}
+		}
+		if fn != nil {
+			fn(p)
+		}
+	}
+}
+
+// RequestLimitStats is the statistics of a request rate limiter.
+type RequestLimitStats struct {
+	// Requests is the count of requests passed the limiter.
+	Requests int64
+	// Waited is the count of requests which have been delayed.
+	Waited int64
+	// WaitTime is the total time requests have been delayed.
+	WaitTime time.Duration
+}
+
+// requestLimiter limits requests per second to avoid being throttled by
+// kodo with 573. A nil requestLimiter doesn't limit anything.
+type requestLimiter struct {
+	l *rateLimiter
+
+	mu    sync.Mutex
+	stats RequestLimitStats
+}
+
+func newRequestLimiter(qps int) *requestLimiter {
+	return &requestLimiter{l: newRateLimiter(int64(qps))}
+}
+
+// wait blocks until a request is allowed or ctx is done.
+func (l *requestLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	delay, err := l.l.wait(ctx, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Requests++
+	if delay > 0 {
+		l.stats.Waited++
+		l.stats.WaitTime += delay
+	}
+	return err
+}
+
+// snapshot returns the current stats, zero stats for nil.
+func (l *requestLimiter) snapshot() RequestLimitStats {
+	if l == nil {
+		return RequestLimitStats{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// RequestLimitStats returns the stats of request rate limiters for
+// metadata operations like stat, list and delete, and data operations
+// like upload and download. Stats are zero if the limiter is not set by
+// metadata_qps or data_qps.
+func (s *Storage) RequestLimitStats() (metadata, data RequestLimitStats) {
+	return s.metadataLimiter.snapshot(), s.dataLimiter.snapshot()
+}
+
+// RequestLimitStats returns the stats of the request rate limiter for
+// bucket management, which is set by metadata_qps.
+func (s *Service) RequestLimitStats() RequestLimitStats {
+	return s.metadataLimiter.snapshot()
+}
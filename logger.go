@@ -0,0 +1,82 @@
+package kodo
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Logger records debug logs of http requests.
+//
+// Arguments are alternating keys and values like `log/slog`, so that
+// *slog.Logger could be used as is.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+}
+
+// redacted replaces secrets in logs.
+const redacted = "REDACTED"
+
+// sensitiveQueryKeys are query keys carrying signatures or credential, like
+// `token` of private url, `sign` of timestamp anti-leech url and `ak` of
+// region query.
+var sensitiveQueryKeys = []string{"token", "sign", "ak"}
+
+// logTransport records every http exchange into logger.
+type logTransport struct {
+	base   http.RoundTripper
+	logger Logger
+}
+
+func (t logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+
+	args := []interface{}{
+		"method", req.Method,
+		"host", req.URL.Host,
+		"path", req.URL.Path,
+	}
+	if req.URL.RawQuery != "" {
+		args = append(args, "query", redactQuery(req.URL.Query()))
+	}
+	if v := req.Header.Get("Authorization"); v != "" {
+		args = append(args, "authorization", redactAuthorization(v))
+	}
+	args = append(args, "duration", time.Since(start))
+	if err != nil {
+		args = append(args, "error", err)
+	} else {
+		args = append(args,
+			"status", resp.StatusCode,
+			"request_id", resp.Header.Get("X-Reqid"))
+	}
+
+	t.logger.DebugContext(req.Context(), "kodo http request", args...)
+	return resp, err
+}
+
+// redactQuery returns the encoded query with signatures redacted.
+func redactQuery(q url.Values) string {
+	for _, k := range sensitiveQueryKeys {
+		if _, ok := q[k]; ok {
+			q.Set(k, redacted)
+		}
+	}
+	return q.Encode()
+}
+
+// redactAuthorization keeps the scheme like `Qiniu` and `UpToken` only.
+func redactAuthorization(v string) string {
+	if idx := strings.Index(v, " "); idx > 0 {
+		return v[:idx] + " " + redacted
+	}
+	return redacted
+}
@@ -0,0 +1,295 @@
+package kodo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// Observer is notified around every operation of Storage, it could be used
+// to collect metrics or to trace operations.
+//
+// Implementations must be safe for concurrent use.
+type Observer interface {
+	// Start is called before the operation starts, the returned context is
+	// used by the operation, and passed to Finish.
+	Start(ctx context.Context, op, path string) context.Context
+	// Finish is called after the operation finished.
+	Finish(ctx context.Context, ev OperationEvent)
+}
+
+// OperationEvent describes a finished operation.
+type OperationEvent struct {
+	// Op is the name of operation like `read` and `write`.
+	Op string
+	// Path is the path of the operation, it's the prefix for `list`.
+	Path string
+	// Duration is how long the operation took.
+	Duration time.Duration
+	// Bytes is the count of bytes read or written.
+	Bytes int64
+	// Retries is the count of requests retried.
+	Retries int
+	// RequestID is the `X-Reqid` of the last response from kodo, it could be empty.
+	RequestID string
+	// ErrorClass is the class of Err like `object_not_exist`, it's empty if succeeded.
+	ErrorClass string
+	// Err is the error returned by the operation.
+	Err error
+}
+
+// Error classes in OperationEvent.
+const (
+	ErrorClassCanceled         = "canceled"
+	ErrorClassObjectNotExist   = "object_not_exist"
+	ErrorClassPermissionDenied = "permission_denied"
+	ErrorClassThrottled        = "request_throttled"
+	ErrorClassServiceInternal  = "service_internal"
+	ErrorClassUnexpected       = "unexpected"
+)
+
+// errorClass returns the class of err, empty for nil.
+func errorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassCanceled
+	}
+
+	err = formatError(err)
+	switch {
+	case errors.Is(err, services.ErrObjectNotExist):
+		return ErrorClassObjectNotExist
+	case errors.Is(err, services.ErrPermissionDenied):
+		return ErrorClassPermissionDenied
+	case errors.Is(err, services.ErrRequestThrottled):
+		return ErrorClassThrottled
+	case errors.Is(err, services.ErrServiceInternal):
+		return ErrorClassServiceInternal
+	default:
+		return ErrorClassUnexpected
+	}
+}
+
+// operationTrace collects retries and request ID of an operation, it's
+// carried by context so that it's shared by all requests of the operation.
+type operationTrace struct {
+	mu        sync.Mutex
+	retries   int
+	requestID string
+}
+
+type operationTraceKey struct{}
+
+func traceFromContext(ctx context.Context) *operationTrace {
+	t, _ := ctx.Value(operationTraceKey{}).(*operationTrace)
+	return t
+}
+
+// addRetry records a retry, it does nothing for nil.
+func (t *operationTrace) addRetry() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.retries++
+	t.mu.Unlock()
+}
+
+// setRequestID records the request ID, it does nothing for nil.
+func (t *operationTrace) setRequestID(id string) {
+	if t == nil || id == "" {
+		return
+	}
+	t.mu.Lock()
+	t.requestID = id
+	t.mu.Unlock()
+}
+
+// traceTransport records request ID of responses into the operation trace
+// of the request.
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+func (t traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err == nil {
+		traceFromContext(req.Context()).setRequestID(resp.Header.Get("X-Reqid"))
+	}
+	return resp, err
+}
+
+// startOperation notifies the observer that op starts, done must be called
+// with bytes and error after op finished. It does nothing if observer is
+// not set or ctx is of an outer operation, so that nested operations like
+// stat in verified read are counted as parts of the outer one.
+func (s *Storage) startOperation(ctx context.Context, op, path string) (context.Context, func(n int64, err error)) {
+	if s.observer == nil || traceFromContext(ctx) != nil {
+		return ctx, func(int64, error) {}
+	}
+
+	start := time.Now()
+	t := &operationTrace{}
+	ctx = context.WithValue(ctx, operationTraceKey{}, t)
+	ctx = s.observer.Start(ctx, op, path)
+
+	return ctx, func(n int64, err error) {
+		t.mu.Lock()
+		ev := OperationEvent{
+			Op:         op,
+			Path:       path,
+			Duration:   time.Since(start),
+			Bytes:      n,
+			Retries:    t.retries,
+			RequestID:  t.requestID,
+			ErrorClass: errorClass(err),
+			Err:        err,
+		}
+		t.mu.Unlock()
+
+		var re *ResponseError
+		if errors.As(err, &re) && re.RequestID != "" {
+			ev.RequestID = re.RequestID
+		}
+		s.observer.Finish(ctx, ev)
+	}
+}
+
+// MultiObserver notifies all observers in order.
+func MultiObserver(observers ...Observer) Observer {
+	return multiObserver(observers)
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) Start(ctx context.Context, op, path string) context.Context {
+	for _, o := range m {
+		ctx = o.Start(ctx, op, path)
+	}
+	return ctx
+}
+
+func (m multiObserver) Finish(ctx context.Context, ev OperationEvent) {
+	for _, o := range m {
+		o.Finish(ctx, ev)
+	}
+}
+
+// MetricsObserver reports operations to counters and histograms, nil
+// functions are skipped.
+//
+// It doesn't depend on any metrics library, functions could be bound to
+// Prometheus vectors like:
+//
+//	kodo.MetricsObserver{
+//	    Count: func(op, errorClass string) {
+//	        ops.WithLabelValues(op, errorClass).Inc()
+//	    },
+//	    Observe: func(op string, seconds float64) {
+//	        latency.WithLabelValues(op).Observe(seconds)
+//	    },
+//	}
+type MetricsObserver struct {
+	// Count is called once per operation, errorClass is empty if succeeded.
+	Count func(op, errorClass string)
+	// Observe is called with the duration of operation in seconds.
+	Observe func(op string, seconds float64)
+	// Bytes is called with bytes read or written, it's skipped for zero.
+	Bytes func(op string, n int64)
+	// Retries is called with retries of operation, it's skipped for zero.
+	Retries func(op string, n int)
+}
+
+// Start implements Observer.
+func (m MetricsObserver) Start(ctx context.Context, op, path string) context.Context {
+	return ctx
+}
+
+// Finish implements Observer.
+func (m MetricsObserver) Finish(ctx context.Context, ev OperationEvent) {
+	if m.Count != nil {
+		m.Count(ev.Op, ev.ErrorClass)
+	}
+	if m.Observe != nil {
+		m.Observe(ev.Op, ev.Duration.Seconds())
+	}
+	if m.Bytes != nil && ev.Bytes > 0 {
+		m.Bytes(ev.Op, ev.Bytes)
+	}
+	if m.Retries != nil && ev.Retries > 0 {
+		m.Retries(ev.Op, ev.Retries)
+	}
+}
+
+// Span is a tracing span, it's a subset of OpenTelemetry trace.Span.
+type Span interface {
+	// SetAttribute sets an attribute of the span.
+	SetAttribute(key string, value interface{})
+	// RecordError records err as an event of the span.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+// TracingObserver starts a span for every operation.
+//
+// It doesn't depend on any tracing library, StartSpan could be bound to an
+// OpenTelemetry tracer with a small Span adapter:
+//
+//	kodo.TracingObserver{
+//	    StartSpan: func(ctx context.Context, name string) (context.Context, kodo.Span) {
+//	        ctx, span := tracer.Start(ctx, name)
+//	        return ctx, otelSpan{span}
+//	    },
+//	}
+type TracingObserver struct {
+	// StartSpan starts a span with name like `kodo.read`, operations are not
+	// traced if it's nil.
+	StartSpan func(ctx context.Context, name string) (context.Context, Span)
+}
+
+type tracingSpanKey struct{}
+
+// Start implements Observer.
+func (o TracingObserver) Start(ctx context.Context, op, path string) context.Context {
+	if o.StartSpan == nil {
+		return ctx
+	}
+	spanCtx, span := o.StartSpan(ctx, "kodo."+op)
+	if span == nil {
+		return ctx
+	}
+	ctx = spanCtx
+	span.SetAttribute("kodo.path", path)
+	return context.WithValue(ctx, tracingSpanKey{}, span)
+}
+
+// Finish implements Observer.
+func (o TracingObserver) Finish(ctx context.Context, ev OperationEvent) {
+	span, ok := ctx.Value(tracingSpanKey{}).(Span)
+	if !ok {
+		return
+	}
+
+	span.SetAttribute("kodo.bytes", ev.Bytes)
+	span.SetAttribute("kodo.retries", ev.Retries)
+	if ev.RequestID != "" {
+		span.SetAttribute("kodo.request_id", ev.RequestID)
+	}
+	if ev.Err != nil {
+		span.SetAttribute("kodo.error_class", ev.ErrorClass)
+		span.RecordError(ev.Err)
+	}
+	span.End()
+}
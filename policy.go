@@ -0,0 +1,139 @@
+package kodo
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	qs "github.com/qiniu/go-sdk/v7/storage"
+)
+
+// PutPolicy is the upload policy used to generate upload tokens.
+//
+// Scope and deadline are managed by the storager, other fields are the same
+// as kodo's put policy.
+//
+// ref: https://developer.qiniu.com/kodo/1206/put-policy
+type PutPolicy struct {
+	// InsertOnly will reject the upload if the object already exists.
+	InsertOnly bool
+	// DetectMime will let kodo detect content type from content, the
+	// content type specified by the client is ignored.
+	DetectMime bool
+
+	// FsizeMin is the min size of object in bytes, 0 means no limit.
+	FsizeMin int64
+	// FsizeLimit is the max size of object in bytes, 0 means no limit.
+	FsizeLimit int64
+	// MimeLimit is the allowed content types separated by `;`, like
+	// `image/*;video/*`. Content types could be denied with a `!` prefix,
+	// like `!application/json;text/plain`.
+	MimeLimit string
+
+	// CallbackURL is the callback urls separated by `;`, kodo will POST
+	// CallbackBody to them after upload succeeded and return the callback
+	// response to the client.
+	CallbackURL string
+	// CallbackHost is the Host header used in callback.
+	CallbackHost string
+	// CallbackBody is the body used in callback, which supports magic
+	// variables like `$(key)`.
+	CallbackBody string
+	// CallbackBodyType is the content type of CallbackBody, could be
+	// `application/x-www-form-urlencoded` (by default) or `application/json`.
+	CallbackBodyType string
+
+	// ReturnBody is the response body of upload, which supports magic
+	// variables like `$(key)`. It's ignored while CallbackURL is set.
+	ReturnBody string
+
+	// PersistentOps is the persistent fops executed after upload.
+	PersistentOps string
+	// PersistentNotifyURL is the url to be notified after PersistentOps finished.
+	PersistentNotifyURL string
+	// PersistentPipeline is the pipeline used to execute PersistentOps.
+	PersistentPipeline string
+
+	// DeleteAfterDays will delete the object after given days, 0 means never.
+	DeleteAfterDays int
+}
+
+// PutResult is the result of a write.
+type PutResult struct {
+	// Key is the key of the written object.
+	Key string
+	// Hash is the etag of the written object, it could be empty if
+	// ReturnBody or callback response doesn't contain it.
+	Hash string
+	// Body is the raw response body of upload. It's the callback response
+	// if CallbackURL is set, or the rendered ReturnBody if it's set.
+	Body []byte
+	// Skipped is true if the upload is skipped by skip_unchanged, Body is
+	// empty in this case.
+	Skipped bool
+}
+
+// validate checks whether the policy could be accepted by kodo.
+func (p PutPolicy) validate() error {
+	if p.FsizeMin < 0 || p.FsizeLimit < 0 {
+		return fmt.Errorf("fsize limit must not be negative")
+	}
+	if p.FsizeLimit > 0 && p.FsizeLimit < p.FsizeMin {
+		return fmt.Errorf("fsize limit %d is less than fsize min %d", p.FsizeLimit, p.FsizeMin)
+	}
+	if p.DeleteAfterDays < 0 {
+		return fmt.Errorf("delete after days must not be negative")
+	}
+
+	if p.CallbackURL == "" {
+		if p.CallbackHost != "" || p.CallbackBody != "" || p.CallbackBodyType != "" {
+			return fmt.Errorf("callback url is required while callback is configured")
+		}
+	} else {
+		for _, v := range strings.Split(p.CallbackURL, ";") {
+			u, err := url.Parse(v)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid callback url %q", v)
+			}
+		}
+		if p.CallbackBody == "" {
+			return fmt.Errorf("callback body is required while callback url is set")
+		}
+	}
+	switch p.CallbackBodyType {
+	case "", "application/x-www-form-urlencoded", "application/json":
+	default:
+		return fmt.Errorf("unsupported callback body type %q", p.CallbackBodyType)
+	}
+
+	if p.PersistentOps == "" && (p.PersistentNotifyURL != "" || p.PersistentPipeline != "") {
+		return fmt.Errorf("persistent ops is required while persistent notify url or pipeline is set")
+	}
+	return nil
+}
+
+// newPutPolicy creates the put policy used by kodo sdk.
+func (s *Storage) newPutPolicy(p PutPolicy) qs.PutPolicy {
+	qp := qs.PutPolicy{
+		Scope:               s.name,
+		FsizeMin:            p.FsizeMin,
+		FsizeLimit:          p.FsizeLimit,
+		MimeLimit:           p.MimeLimit,
+		CallbackURL:         p.CallbackURL,
+		CallbackHost:        p.CallbackHost,
+		CallbackBody:        p.CallbackBody,
+		CallbackBodyType:    p.CallbackBodyType,
+		ReturnBody:          p.ReturnBody,
+		PersistentOps:       p.PersistentOps,
+		PersistentNotifyURL: p.PersistentNotifyURL,
+		PersistentPipeline:  p.PersistentPipeline,
+		DeleteAfterDays:     p.DeleteAfterDays,
+	}
+	if p.InsertOnly {
+		qp.InsertOnly = 1
+	}
+	if p.DetectMime {
+		qp.DetectMime = 1
+	}
+	return qp
+}
@@ -0,0 +1,97 @@
+package kodo
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"hash"
+)
+
+// qetagBlockSize is the size of blocks in qetag.
+const qetagBlockSize = 4 * 1024 * 1024
+
+// QetagHash computes the qetag of content, which is the `Hash` of objects
+// in kodo.
+//
+// Content is split into 4MB blocks. For content of one block, qetag is
+// 0x16 followed by SHA1 of the content. Otherwise, it's 0x96 followed by
+// SHA1 of the concatenated SHA1 of blocks. The result is encoded with url
+// safe base64.
+//
+// ref: https://github.com/qiniu/qetag
+type QetagHash struct {
+	block   hash.Hash
+	written int64
+	sums    []byte
+}
+
+var _ hash.Hash = (*QetagHash)(nil)
+
+// NewQetagHash creates a QetagHash.
+func NewQetagHash() *QetagHash {
+	return &QetagHash{block: sha1.New()}
+}
+
+// Write implements io.Writer, it never returns an error.
+func (h *QetagHash) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		left := qetagBlockSize - int(h.written%qetagBlockSize)
+		if left > len(p) {
+			left = len(p)
+		}
+		h.block.Write(p[:left])
+		h.written += int64(left)
+		n += left
+		p = p[left:]
+
+		if h.written%qetagBlockSize == 0 {
+			h.sums = h.block.Sum(h.sums)
+			h.block.Reset()
+		}
+	}
+	return n, nil
+}
+
+// Sum appends the raw qetag of 21 bytes to b.
+func (h *QetagHash) Sum(b []byte) []byte {
+	sums := h.sums
+	if h.written == 0 || h.written%qetagBlockSize != 0 {
+		sums = h.block.Sum(sums[:len(sums):len(sums)])
+	}
+
+	if len(sums) == sha1.Size {
+		return append(append(b, 0x16), sums...)
+	}
+	sum := sha1.Sum(sums)
+	return append(append(b, 0x96), sum[:]...)
+}
+
+// Reset resets the hash to its initial state.
+func (h *QetagHash) Reset() {
+	h.block.Reset()
+	h.written = 0
+	h.sums = h.sums[:0]
+}
+
+// Size returns the size of raw qetag.
+func (h *QetagHash) Size() int {
+	return 1 + sha1.Size
+}
+
+// BlockSize returns the size of qetag blocks.
+func (h *QetagHash) BlockSize() int {
+	return qetagBlockSize
+}
+
+// Etag returns the encoded qetag, which could be compared with etag of
+// objects directly.
+func (h *QetagHash) Etag() string {
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// isQetag checks whether etag is a qetag. Objects uploaded by multipart
+// upload with parts other than 4MB have etag v2 prefixed with 0x9e, which
+// could not be verified.
+func isQetag(etag string) bool {
+	bs, err := base64.URLEncoding.DecodeString(etag)
+	return err == nil && len(bs) == 1+sha1.Size && (bs[0] == 0x16 || bs[0] == 0x96)
+}
@@ -0,0 +1,206 @@
+package kodo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+// readAheadSize is the min size of range requests sent by ObjectReader.Read.
+const readAheadSize = 128 * 1024
+
+// ObjectReader is a handle of an object which supports random access.
+//
+// It implements io.ReaderAt, io.ReadSeeker and io.Closer, all reads are
+// served by range requests protected by the etag learned in Open, so
+// reading an object which has been overwritten will fail. ReadAt is safe
+// for concurrent use, while Read and Seek are not.
+type ObjectReader struct {
+	s    *Storage
+	ctx  context.Context
+	path string
+	key  string
+	size int64
+	etag string
+
+	// offset is the position of Read and Seek.
+	offset int64
+	// buf holds the read-ahead content which starts at bufOffset.
+	buf       []byte
+	bufOffset int64
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Open opens the object at path for random access.
+func (s *Storage) Open(path string) (r *ObjectReader, err error) {
+	ctx := context.Background()
+	return s.OpenWithContext(ctx, path)
+}
+
+// OpenWithContext opens the object at path for random access, ctx is used
+// by all requests of the returned ObjectReader.
+func (s *Storage) OpenWithContext(ctx context.Context, path string) (r *ObjectReader, err error) {
+	defer func() {
+		err = s.formatError("open", err, path)
+	}()
+	opCtx, done := s.startOperation(ctx, "open", path)
+	defer func() { done(0, err) }()
+
+	o, err := s.stat(opCtx, path, pairStorageStat{})
+	if err != nil {
+		return nil, err
+	}
+	size, ok := o.GetContentLength()
+	if !ok {
+		return nil, services.ErrObjectNotExist
+	}
+	etag, _ := o.GetEtag()
+
+	return &ObjectReader{
+		s:    s,
+		ctx:  ctx,
+		path: path,
+		key:  o.ID,
+		size: size,
+		etag: etag,
+	}, nil
+}
+
+// Size returns the size of the object.
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *ObjectReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if err = r.checkClosed(); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, r.s.formatError("read_at", errors.New("negative offset"), r.path)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n = len(p)
+	if int64(n) > r.size-off {
+		n = int(r.size - off)
+	}
+	if err = r.fetch(p[:n], off); err != nil {
+		return 0, r.s.formatError("read_at", err, r.path)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (r *ObjectReader) Read(p []byte) (n int, err error) {
+	if err = r.checkClosed(); err != nil {
+		return 0, err
+	}
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if r.offset < r.bufOffset || r.offset >= r.bufOffset+int64(len(r.buf)) {
+		want := int64(len(p))
+		if want < readAheadSize {
+			want = readAheadSize
+		}
+		if want > r.size-r.offset {
+			want = r.size - r.offset
+		}
+
+		buf := make([]byte, want)
+		if err = r.fetch(buf, r.offset); err != nil {
+			return 0, r.s.formatError("read", err, r.path)
+		}
+		r.buf, r.bufOffset = buf, r.offset
+	}
+
+	n = copy(p, r.buf[r.offset-r.bufOffset:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker.
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	if err := r.checkClosed(); err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, r.s.formatError("seek", errors.New("invalid whence"), r.path)
+	}
+	if offset < 0 {
+		return 0, r.s.formatError("seek", errors.New("negative position"), r.path)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close implements io.Closer, the reader could not be used after closed.
+func (r *ObjectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+	r.closed = true
+	r.buf = nil
+	return nil
+}
+
+func (r *ObjectReader) checkClosed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+// fetch fills p with content starting at off.
+func (r *ObjectReader) fetch(p []byte, off int64) error {
+	s := r.s
+	return s.retry.do(r.ctx, func() error {
+		resp, _, err := s.getObject(r.ctx, r.key, s.urlLifetime, off, int64(len(p)), r.etag)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusPartialContent {
+			return errors.New("range request is not supported by download domain")
+		}
+		if err = checkEtag(resp, r.etag); err != nil {
+			return err
+		}
+		_, err = io.ReadFull(resp.Body, p)
+		return err
+	})
+}
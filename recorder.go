@@ -0,0 +1,145 @@
+package kodo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultUploadRecordExpiry = 5 * 24 * time.Hour
+
+// Recorder persists progress of multipart uploads.
+//
+// Implementations must be safe for concurrent use.
+type Recorder interface {
+	// Get returns the record of key, nil will be returned if not exist.
+	Get(key string) ([]byte, error)
+	// Set saves the record of key.
+	Set(key string, data []byte) error
+	// Delete removes the record of key, it's not an error if not exist.
+	Delete(key string) error
+}
+
+// NewFileRecorder creates a Recorder which saves records as files in dir.
+func NewFileRecorder(dir string) (Recorder, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return fileRecorder{dir: dir}, nil
+}
+
+type fileRecorder struct {
+	dir string
+}
+
+func (r fileRecorder) Get(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(r.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Set writes into a temp file and renames it, so that a crash never leaves
+// a broken record.
+func (r fileRecorder) Set(key string, data []byte) error {
+	f, err := ioutil.TempFile(r.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), r.path(key))
+}
+
+func (r fileRecorder) Delete(key string) error {
+	err := os.Remove(r.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (r fileRecorder) path(key string) string {
+	return filepath.Join(r.dir, key)
+}
+
+// uploadRecord is the progress of a multipart upload.
+type uploadRecord struct {
+	UploadID string         `json:"upload_id"`
+	Host     string         `json:"host"`
+	PartSize int64          `json:"part_size"`
+	Parts    []uploadedPart `json:"parts"`
+	// Offset is the size of uploaded content, only the last part could be
+	// smaller than PartSize.
+	Offset    int64 `json:"offset"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+// valid reports whether the record is consistent with itself and could be
+// resumed by content with given size, size < 0 means unknown.
+func (rec *uploadRecord) valid(size int64) bool {
+	parts := int64(len(rec.Parts))
+	if parts == 0 {
+		return rec.Offset == 0
+	}
+	if rec.Offset <= (parts-1)*rec.PartSize || rec.Offset > parts*rec.PartSize {
+		return false
+	}
+	if size < 0 {
+		return true
+	}
+	// Content ends at the last part if it's smaller than PartSize.
+	if rec.Offset < parts*rec.PartSize {
+		return rec.Offset == size
+	}
+	return rec.Offset <= size
+}
+
+// uploadRecordKey returns the key of record, which is decided by the object
+// and the source.
+func (s *Storage) uploadRecordKey(key, sourceID string) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%s", s.name, key, sourceID)))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadUploadRecord returns the record which could be resumed, or nil if not exist.
+//
+// Records which are expired, broken, created with another part size or not
+// matching the content with given size will be deleted.
+func (s *Storage) loadUploadRecord(recordKey string, partSize, size int64) *uploadRecord {
+	data, err := s.recorder.Get(recordKey)
+	if err != nil || data == nil {
+		return nil
+	}
+
+	rec := &uploadRecord{}
+	err = json.Unmarshal(data, rec)
+	if err != nil || rec.UploadID == "" || rec.PartSize != partSize || !rec.valid(size) ||
+		time.Since(time.Unix(rec.CreatedAt, 0)) > s.uploadRecordExpiry {
+		_ = s.recorder.Delete(recordKey)
+		return nil
+	}
+	return rec
+}
+
+func (s *Storage) saveUploadRecord(recordKey string, rec *uploadRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.recorder.Set(recordKey, data)
+}
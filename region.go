@@ -0,0 +1,139 @@
+package kodo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	qs "github.com/qiniu/go-sdk/v7/storage"
+)
+
+// regionCache holds the region of bucket queried from uc until its ttl
+// expires. regionCache is safe for concurrent use.
+type regionCache struct {
+	mu       sync.Mutex
+	region   *qs.Region
+	deadline time.Time
+}
+
+// region returns the region of bucket, ak is the access key of the bucket
+// owner. The configured zone is used if it's set by api endpoint.
+//
+// qs.GetRegion is not used because it queries uc with context.Background()
+// and the default client of sdk, so that it could neither be canceled nor be
+// logged.
+func (s *Storage) region(ctx context.Context, ak string) (*qs.Region, error) {
+	if zone := s.bucket.Cfg.Zone; zone != nil {
+		return zone, nil
+	}
+
+	s.regions.mu.Lock()
+	region, deadline := s.regions.region, s.regions.deadline
+	s.regions.mu.Unlock()
+	if region != nil && time.Now().Before(deadline) {
+		return region, nil
+	}
+
+	query := url.Values{}
+	query.Set("ak", ak)
+	query.Set("bucket", s.name)
+	reqURL := s.ucHost + "/v2/query?" + query.Encode()
+
+	var ret qs.UcQueryRet
+	err := s.retry.do(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return err
+		}
+		if err = s.metadataLimiter.wait(ctx); err != nil {
+			return err
+		}
+		return doRequest(ctx, s.bucket.Client, req, &ret)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ioHosts := ret.Io["src"]["main"]
+	if len(ioHosts) == 0 {
+		return nil, errors.New("empty io host list")
+	}
+	region = &qs.Region{
+		SrcUpHosts: append(ret.Up["src"].Main, ret.Up["src"].Backup...),
+		CdnUpHosts: append(ret.Up["acc"].Main, ret.Up["acc"].Backup...),
+		IovipHost:  ioHosts[0],
+		RsHost:     qs.DefaultRsHost,
+		RsfHost:    qs.DefaultRsfHost,
+		ApiHost:    qs.DefaultAPIHost,
+	}
+	if r, ok := regionFromIoHost(region.IovipHost); ok {
+		region.RsHost, region.RsfHost, region.ApiHost = r.RsHost, r.RsfHost, r.ApiHost
+	}
+
+	s.regions.mu.Lock()
+	s.regions.region = region
+	s.regions.deadline = time.Now().Add(time.Duration(ret.TTL) * time.Second)
+	s.regions.mu.Unlock()
+	return region, nil
+}
+
+// regionFromIoHost finds the region of io host like `iovip-z1.qbox.me`,
+// which is the same as the sdk does.
+func regionFromIoHost(host string) (qs.Region, bool) {
+	for suffix, id := range map[string]qs.RegionID{
+		"-z1":  qs.RIDHuabei,
+		"-z2":  qs.RIDHuanan,
+		"-na0": qs.RIDNorthAmerica,
+		"-as0": qs.RIDSingapore,
+	} {
+		if strings.Contains(host, suffix) {
+			return qs.GetRegionByID(id)
+		}
+	}
+	return qs.Region{}, false
+}
+
+// rsHost returns the url of rs host like `https://rs.qiniu.com`.
+func (s *Storage) rsHost(ctx context.Context) (string, error) {
+	cfg := s.bucket.Cfg
+	if cfg.RsHost != "" {
+		return withScheme(cfg.RsHost), nil
+	}
+	if s.bucket.Mac == nil {
+		return "", errCredentialRequired
+	}
+
+	region, err := s.region(ctx, s.bucket.Mac.AccessKey)
+	if err != nil {
+		return "", err
+	}
+	return region.GetRsHost(cfg.UseHTTPS), nil
+}
+
+// rsfHost returns the url of rsf host like `https://rsf.qiniu.com`.
+func (s *Storage) rsfHost(ctx context.Context) (string, error) {
+	cfg := s.bucket.Cfg
+	if cfg.RsfHost != "" {
+		return withScheme(cfg.RsfHost), nil
+	}
+	if s.bucket.Mac == nil {
+		return "", errCredentialRequired
+	}
+
+	region, err := s.region(ctx, s.bucket.Mac.AccessKey)
+	if err != nil {
+		return "", err
+	}
+	return region.GetRsfHost(cfg.UseHTTPS), nil
+}
+
+func withScheme(host string) string {
+	if strings.HasPrefix(host, "http") {
+		return host
+	}
+	return "http://" + host
+}
@@ -0,0 +1,108 @@
+package kodo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	qs "github.com/qiniu/go-sdk/v7/storage"
+
+	"github.com/beyondstorage/go-service-kodo/v2/kodotest"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/types"
+)
+
+// newRegionTestStorage creates a storage whose region is queried from srv,
+// and the storage inherits metadata_qps from the service.
+func newRegionTestStorage(t *testing.T, srv *kodotest.Server, pairs ...types.Pair) (*Service, *Storage) {
+	service, err := newServicer(append(pairs,
+		ps.WithCredential(srv.Credential()),
+		WithAPIEndpoint(srv.Endpoint()),
+		WithMetadataQPS(100),
+	)...)
+	if err != nil {
+		t.Fatalf("new servicer: %v", err)
+	}
+	// Zone set by api endpoint is dropped, so that region is queried from uc.
+	service.service.Cfg.Zone = nil
+
+	store, err := service.newStorage(ps.WithName(srv.Bucket), ps.WithEndpoint(srv.Endpoint()))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	return service, store
+}
+
+func TestRegionQuery(t *testing.T) {
+	srv := kodotest.NewServer("test-bucket")
+	defer srv.Close()
+
+	service, store := newRegionTestStorage(t, srv)
+	if store.metadataLimiter == nil || store.metadataLimiter != service.metadataLimiter {
+		t.Fatal("expect metadata limiter inherited from service")
+	}
+
+	for i := 0; i < 2; i++ {
+		region, err := store.region(context.Background(), store.bucket.Mac.AccessKey)
+		if err != nil {
+			t.Fatalf("region: %v", err)
+		}
+		if region.IovipHost != srv.Listener.Addr().String() {
+			t.Errorf("unexpected io host %s", region.IovipHost)
+		}
+	}
+
+	// The second query is served by cache.
+	metadata, _ := store.RequestLimitStats()
+	if metadata.Requests != 1 {
+		t.Errorf("expect 1 region query waited on metadata limiter, got %d", metadata.Requests)
+	}
+}
+
+type recordLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordLogger) DebugContext(ctx context.Context, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintln(append([]interface{}{msg}, args...)...))
+}
+
+func TestRegionQueryLogged(t *testing.T) {
+	srv := kodotest.NewServer("test-bucket")
+	defer srv.Close()
+
+	l := &recordLogger{}
+	_, store := newRegionTestStorage(t, srv, WithLogger(l))
+	if _, err := store.region(context.Background(), store.bucket.Mac.AccessKey); err != nil {
+		t.Fatalf("region: %v", err)
+	}
+
+	all := strings.Join(l.logs, "\n")
+	if !strings.Contains(all, "path /v2/query") || !strings.Contains(all, "ak=REDACTED") {
+		t.Errorf("expect region query in logs:\n%s", all)
+	}
+	if strings.Contains(all, kodotest.AccessKey) {
+		t.Errorf("access key is not redacted in logs:\n%s", all)
+	}
+}
+
+func TestUpHostEmpty(t *testing.T) {
+	srv := kodotest.NewServer("test-bucket")
+	defer srv.Close()
+
+	_, store := newRegionTestStorage(t, srv)
+	store.bucket.Cfg.Zone = &qs.Region{}
+
+	token, err := store.uploadToken(context.Background(), store.putPolicy)
+	if err != nil {
+		t.Fatalf("upload token: %v", err)
+	}
+	if _, err = store.upHost(context.Background(), token); err == nil {
+		t.Error("expect error for empty up hosts")
+	}
+}
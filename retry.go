@@ -0,0 +1,107 @@
+package kodo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay    = 10 * time.Second
+)
+
+// retryer will retry a request with exponential backoff and full jitter.
+//
+// Only idempotent requests should be sent via retryer, the caller is
+// responsible for rewinding the request body between attempts.
+type retryer struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func newRetryer() retryer {
+	return retryer{
+		maxAttempts: defaultRetryMaxAttempts,
+		baseDelay:   defaultRetryBaseDelay,
+		maxDelay:    defaultRetryMaxDelay,
+	}
+}
+
+// do will call fn until it succeeds, returns a non-retryable error or
+// reaches max attempts.
+func (r retryer) do(ctx context.Context, fn func() error) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= r.maxAttempts || !isRetryableError(err) {
+			return err
+		}
+		traceFromContext(ctx).addRetry()
+
+		t := time.NewTimer(r.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// backoff returns the delay before next attempt.
+//
+// ref: https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func (r retryer) backoff(attempt int) time.Duration {
+	d := r.baseDelay << uint(attempt-1)
+	if d <= 0 || d > r.maxDelay {
+		d = r.maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d))) + 1
+}
+
+// isRetryableError checks whether err is a transient failure.
+//
+// Errors returned by kodo are classified by classifyErrorCode, and only internal
+// errors and throttling are retried. Connection level failures like reset
+// or unexpected EOF are retried as well.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if code, ok := getErrorCode(err); ok {
+		ce := classifyErrorCode(code)
+		return ce == services.ErrServiceInternal || ce == services.ErrRequestThrottled
+	}
+
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	if errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var oe *net.OpError
+	if errors.As(err, &oe) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
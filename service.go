@@ -18,7 +18,7 @@ func (s *Service) create(ctx context.Context, name string, opt pairServiceCreate
 		return nil, err
 	}
 
-	err = s.service.CreateBucket(name, qs.RegionID(opt.Location))
+	err = s.createBucket(ctx, name, qs.RegionID(opt.Location))
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +31,7 @@ func (s *Service) create(ctx context.Context, name string, opt pairServiceCreate
 }
 
 func (s *Service) delete(ctx context.Context, name string, opt pairServiceDelete) (err error) {
-	err = s.service.DropBucket(name)
+	err = s.dropBucket(ctx, name)
 	if err != nil {
 		return err
 	}
@@ -53,7 +53,11 @@ func (s *Service) list(ctx context.Context, opt pairServiceList) (it *typ.Storag
 }
 
 func (s *Service) nextStoragePage(ctx context.Context, page *typ.StoragerPage) error {
-	buckets, err := s.service.Buckets(false)
+	var buckets []string
+	err := s.retry.do(ctx, func() (err error) {
+		buckets, err = s.listBuckets(ctx)
+		return err
+	})
 	if err != nil {
 		return err
 	}
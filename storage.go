@@ -2,8 +2,14 @@ package kodo
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	qs "github.com/qiniu/go-sdk/v7/storage"
@@ -14,6 +20,35 @@ import (
 	. "github.com/beyondstorage/go-storage/v4/types"
 )
 
+// WriteObject will write content into path like Write, and returns the
+// written object filled from the upload response, so that a Stat after
+// Write is not needed.
+func (s *Storage) WriteObject(path string, r io.Reader, size int64, pairs ...Pair) (o *Object, err error) {
+	ctx := context.Background()
+	return s.WriteObjectWithContext(ctx, path, r, size, pairs...)
+}
+
+// WriteObjectWithContext will write content into path like WriteWithContext,
+// and returns the written object.
+//
+// Content type is only available while put policy has neither ReturnBody nor
+// callback, and storage class is only available while the upload token is
+// issued by the storager.
+func (s *Storage) WriteObjectWithContext(ctx context.Context, path string, r io.Reader, size int64, pairs ...Pair) (o *Object, err error) {
+	defer func() {
+		err = s.formatError("write_object", err, path)
+	}()
+
+	pairs = append(pairs, s.defaultPairs.Write...)
+	opt, err := s.parsePairStorageWrite(pairs)
+	if err != nil {
+		return
+	}
+
+	_, o, err = s.put(ctx, path, r, size, opt, true)
+	return
+}
+
 func (s *Storage) create(path string, opt pairStorageCreate) (o *Object) {
 	rp := s.getAbsPath(path)
 
@@ -35,6 +70,9 @@ func (s *Storage) create(path string, opt pairStorageCreate) (o *Object) {
 }
 
 func (s *Storage) createDir(ctx context.Context, path string, opt pairStorageCreateDir) (o *Object, err error) {
+	ctx, done := s.startOperation(ctx, "create_dir", path)
+	defer func() { done(0, err) }()
+
 	if !s.features.VirtualDir {
 		err = NewOperationNotImplementedError("create_dir")
 		return
@@ -46,10 +84,28 @@ func (s *Storage) createDir(ctx context.Context, path string, opt pairStorageCre
 	// ref: https://developer.qiniu.com/kodo/kb/1705/how-to-create-the-folder-under-the-space
 	rp += "/"
 
-	uploader := qs.NewFormUploader(s.bucket.Cfg)
+	// Directories are empty markers, limits and callbacks in storage level
+	// put policy are not applied to them.
+	putPolicy := qs.PutPolicy{Scope: s.name}
+
+	uploader := qs.NewFormUploaderEx(s.bucket.Cfg, s.bucket.Client)
 	ret := qs.PutRet{}
-	err = uploader.Put(ctx,
-		&ret, s.putPolicy.UploadToken(s.bucket.Mac), rp, io.LimitReader(nil, 0), 0, nil)
+	// Creating an empty object is idempotent, so it's safe to retry.
+	err = s.retry.do(ctx, func() error {
+		token, err := s.uploadToken(ctx, putPolicy)
+		if err != nil {
+			return err
+		}
+		host, err := s.upHost(ctx, token)
+		if err != nil {
+			return err
+		}
+		if err = s.dataLimiter.wait(ctx); err != nil {
+			return err
+		}
+		return uploader.Put(ctx,
+			&ret, token, rp, io.LimitReader(nil, 0), 0, &qs.PutExtra{UpHost: host})
+	})
 	if err != nil {
 		return
 	}
@@ -62,6 +118,9 @@ func (s *Storage) createDir(ctx context.Context, path string, opt pairStorageCre
 }
 
 func (s *Storage) delete(ctx context.Context, path string, opt pairStorageDelete) (err error) {
+	ctx, done := s.startOperation(ctx, "delete", path)
+	defer func() { done(0, err) }()
+
 	rp := s.getAbsPath(path)
 
 	if opt.HasObjectMode && opt.ObjectMode.IsDir() {
@@ -73,7 +132,9 @@ func (s *Storage) delete(ctx context.Context, path string, opt pairStorageDelete
 		rp += "/"
 	}
 
-	err = s.bucket.Delete(s.name, rp)
+	err = s.retry.do(ctx, func() error {
+		return s.deleteObject(ctx, rp)
+	})
 	if err != nil && checkError(err, responseCodeResourceNotExist) {
 		// Omit `612`(resource to be deleted dose not exist) error code here
 		//
@@ -119,18 +180,18 @@ func (s *Storage) metadata(opt pairStorageMetadata) (meta *StorageMeta) {
 func (s *Storage) nextObjectPageByDir(ctx context.Context, page *ObjectPage) error {
 	input := page.Status.(*objectPageStatus)
 
-	entries, commonPrefix, nextMarker, _, err := s.bucket.ListFiles(
-		s.name,
-		input.prefix,
-		input.delimiter,
-		input.marker,
-		input.limit,
-	)
+	ctx, done := s.startOperation(ctx, "list", s.getRelPath(input.prefix))
+	var ret listObjectsResult
+	err := s.retry.do(ctx, func() (err error) {
+		ret, err = s.listObjects(ctx, input.prefix, input.delimiter, input.marker, input.limit)
+		return err
+	})
+	done(0, err)
 	if err != nil {
 		return err
 	}
 
-	for _, v := range commonPrefix {
+	for _, v := range ret.CommonPrefixes {
 		o := s.newObject(true)
 		o.ID = v
 		o.Path = s.getRelPath(v)
@@ -139,7 +200,7 @@ func (s *Storage) nextObjectPageByDir(ctx context.Context, page *ObjectPage) err
 		page.Data = append(page.Data, o)
 	}
 
-	for _, v := range entries {
+	for _, v := range ret.Items {
 		o, err := s.formatFileObject(v)
 		if err != nil {
 			return err
@@ -148,29 +209,29 @@ func (s *Storage) nextObjectPageByDir(ctx context.Context, page *ObjectPage) err
 		page.Data = append(page.Data, o)
 	}
 
-	if nextMarker == "" {
+	if ret.Marker == "" {
 		return IterateDone
 	}
 
-	input.marker = nextMarker
+	input.marker = ret.Marker
 	return nil
 }
 
 func (s *Storage) nextObjectPageByPrefix(ctx context.Context, page *ObjectPage) error {
 	input := page.Status.(*objectPageStatus)
 
-	entries, _, nextMarker, _, err := s.bucket.ListFiles(
-		s.name,
-		input.prefix,
-		input.delimiter,
-		input.marker,
-		input.limit,
-	)
+	ctx, done := s.startOperation(ctx, "list", s.getRelPath(input.prefix))
+	var ret listObjectsResult
+	err := s.retry.do(ctx, func() (err error) {
+		ret, err = s.listObjects(ctx, input.prefix, input.delimiter, input.marker, input.limit)
+		return err
+	})
+	done(0, err)
 	if err != nil {
 		return err
 	}
 
-	for _, v := range entries {
+	for _, v := range ret.Items {
 		o, err := s.formatFileObject(v)
 		if err != nil {
 			return err
@@ -179,51 +240,140 @@ func (s *Storage) nextObjectPageByPrefix(ctx context.Context, page *ObjectPage)
 		page.Data = append(page.Data, o)
 	}
 
-	if nextMarker == "" {
+	if ret.Marker == "" {
 		return IterateDone
 	}
 
-	input.marker = nextMarker
+	input.marker = ret.Marker
 	return nil
 }
 
 func (s *Storage) read(ctx context.Context, path string, w io.Writer, opt pairStorageRead) (n int64, err error) {
+	ctx, done := s.startOperation(ctx, "read", path)
+	defer func() { done(n, err) }()
+
 	rp := s.getAbsPath(path)
 
-	deadline := time.Now().Add(time.Hour).Unix()
-	url := qs.MakePrivateURL(s.bucket.Mac, s.domain, rp, deadline)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return 0, err
+	lifetime := s.urlLifetime
+	if opt.HasURLLifetime {
+		if opt.URLLifetime <= 0 {
+			return 0, services.PairUnsupportedError{Pair: WithURLLifetime(opt.URLLifetime)}
+		}
+		lifetime = time.Duration(opt.URLLifetime) * time.Second
+	}
+	concurrency, partSize := s.readConcurrency, s.readPartSize
+	if opt.HasReadConcurrency {
+		if opt.ReadConcurrency < 1 {
+			return 0, services.PairUnsupportedError{Pair: WithReadConcurrency(opt.ReadConcurrency)}
+		}
+		concurrency = opt.ReadConcurrency
+	}
+	if opt.HasReadPartSize {
+		if opt.ReadPartSize <= 0 {
+			return 0, services.PairUnsupportedError{Pair: WithReadPartSize(opt.ReadPartSize)}
+		}
+		partSize = opt.ReadPartSize
 	}
 
-	resp, err := s.bucket.Client.Do(ctx, req)
-	if err != nil {
-		return 0, err
+	resumes := s.readResumeAttempts
+	if opt.HasReadResumeAttempts {
+		if opt.ReadResumeAttempts < 0 {
+			return 0, services.PairUnsupportedError{Pair: WithReadResumeAttempts(opt.ReadResumeAttempts)}
+		}
+		resumes = opt.ReadResumeAttempts
 	}
 
-	defer func() {
-		cerr := resp.Body.Close()
-		if cerr != nil {
-			err = cerr
+	var offset int64
+	size := int64(-1)
+	if opt.HasOffset {
+		if opt.Offset < 0 {
+			return 0, services.PairUnsupportedError{Pair: ps.WithOffset(opt.Offset)}
 		}
-	}()
+		offset = opt.Offset
+	}
+	if opt.HasSize {
+		if opt.Size < 0 {
+			return 0, services.PairUnsupportedError{Pair: ps.WithSize(opt.Size)}
+		}
+		if opt.Size == 0 {
+			return 0, nil
+		}
+		size = opt.Size
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		err = qs.ResponseError(resp)
-		return 0, err
+	var opLimiter *rateLimiter
+	if opt.HasRateLimit {
+		if opt.RateLimit <= 0 {
+			return 0, services.PairUnsupportedError{Pair: WithRateLimit(opt.RateLimit)}
+		}
+		opLimiter = newRateLimiter(opt.RateLimit)
+	}
+	if fn := limitCallback(ctx, opt.IoCallback, s.readLimiter, opLimiter); fn != nil {
+		w = iowrap.CallbackWriter(w, fn)
 	}
 
-	rc := resp.Body
+	var h *QetagHash
+	var etag string
+	if opt.HasVerifyChecksum && opt.VerifyChecksum {
+		// Only the whole object could be verified.
+		if offset > 0 || size >= 0 {
+			return 0, services.PairUnsupportedError{Pair: WithVerifyChecksum(opt.VerifyChecksum)}
+		}
+		o, err := s.stat(ctx, path, pairStorageStat{})
+		if err != nil {
+			return 0, err
+		}
+		etag, _ = o.GetEtag()
+		if !isQetag(etag) {
+			return 0, fmt.Errorf("%w: hash %s is not a qetag", ErrChecksumUnverifiable, etag)
+		}
+		h = NewQetagHash()
+		w = io.MultiWriter(w, h)
+	}
 
-	if opt.HasIoCallback {
-		rc = iowrap.CallbackReadCloser(resp.Body, opt.IoCallback)
+	var domain string
+	if concurrency > 1 {
+		n, domain, err = s.readParallel(ctx, w, rp, lifetime, offset, size, partSize, concurrency, resumes)
+	} else {
+		n, domain, err = s.readSequential(ctx, w, rp, lifetime, offset, size, resumes)
+	}
+	if err != nil {
+		return n, err
+	}
+	if h != nil && h.Etag() != etag {
+		return n, fmt.Errorf("%w: expect %s, got %s", ErrChecksumMismatch, etag, h.Etag())
 	}
 
-	return io.Copy(w, rc)
+	if opt.HasReadResult {
+		*opt.ReadResult = ReadResult{Endpoint: domain}
+	}
+	return n, nil
+}
+
+func (s *Storage) readSequential(ctx context.Context, w io.Writer, key string, lifetime time.Duration,
+	offset, size int64, resumes int) (n int64, domain string, err error) {
+	var resp *http.Response
+	err = s.retry.do(ctx, func() (err error) {
+		resp, domain, err = s.getObject(ctx, key, lifetime, offset, size, "")
+		return err
+	})
+	if err != nil {
+		return 0, domain, err
+	}
+
+	if resp.StatusCode == http.StatusOK && (offset > 0 || size >= 0) {
+		// Range is ignored by the domain, read from the whole content.
+		n, err = copyRange(w, resp, offset, size)
+		return n, domain, err
+	}
+	n, err = s.copyWithResume(ctx, w, resp, key, lifetime, offset, size, resumes)
+	return n, domain, err
 }
 
 func (s *Storage) stat(ctx context.Context, path string, opt pairStorageStat) (o *Object, err error) {
+	ctx, done := s.startOperation(ctx, "stat", path)
+	defer func() { done(0, err) }()
+
 	rp := s.getAbsPath(path)
 
 	if opt.HasObjectMode && opt.ObjectMode.IsDir() {
@@ -235,11 +385,6 @@ func (s *Storage) stat(ctx context.Context, path string, opt pairStorageStat) (o
 		rp += "/"
 	}
 
-	fi, err := s.bucket.Stat(s.name, rp)
-	if err != nil {
-		return nil, err
-	}
-
 	o = s.newObject(true)
 	o.ID = rp
 	o.Path = path
@@ -249,36 +394,219 @@ func (s *Storage) stat(ctx context.Context, path string, opt pairStorageStat) (o
 		o.Mode |= ModeRead
 	}
 
-	o.SetLastModified(convertUnixTimestampToTime(fi.PutTime))
-	o.SetContentLength(fi.Fsize)
-
-	if fi.Hash != "" {
-		o.SetEtag(fi.Hash)
+	if s.anonymous {
+		return s.statPublicObject(ctx, o)
 	}
-	if fi.MimeType != "" {
-		o.SetContentType(fi.MimeType)
+
+	var fi qs.FileInfo
+	err = s.retry.do(ctx, func() (err error) {
+		fi, err = s.statObject(ctx, rp)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	var sm ObjectSystemMetadata
-	sm.StorageClass = fi.Type
-	o.SetSystemMetadata(sm)
+	setFileInfo(o, fi)
 
 	return o, nil
 }
 
-func (s *Storage) write(ctx context.Context, path string, r io.Reader, size int64, opt pairStorageWrite) (n int64, err error) {
-	if opt.HasIoCallback {
-		r = iowrap.CallbackReader(r, opt.IoCallback)
+// statPublicObject will fill o with headers of download domain, storage
+// class is not available.
+func (s *Storage) statPublicObject(ctx context.Context, o *Object) (*Object, error) {
+	var header http.Header
+	err := s.retry.do(ctx, func() (err error) {
+		header, err = s.headObject(ctx, o.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	if v := header.Get("Content-Length"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		o.SetContentLength(size)
+	}
+	if v := header.Get("Last-Modified"); v != "" {
+		t, err := http.ParseTime(v)
+		if err != nil {
+			return nil, err
+		}
+		o.SetLastModified(t)
+	}
+	if v := header.Get("ETag"); v != "" {
+		o.SetEtag(strings.Trim(v, `"`))
+	}
+	if v := header.Get("Content-Type"); v != "" {
+		o.SetContentType(v)
+	}
+	return o, nil
+}
+
+func (s *Storage) write(ctx context.Context, path string, r io.Reader, size int64, opt pairStorageWrite) (n int64, err error) {
+	n, _, err = s.put(ctx, path, r, size, opt, false)
+	return
+}
+
+// objectReturnBody is used to get info of the written object from upload
+// response, while ReturnBody is not set by the user.
+//
+// ref: https://developer.qiniu.com/kodo/1235/vars#magicvar
+const objectReturnBody = `{"key":"$(key)","hash":"$(etag)","fsize":$(fsize),"mimeType":"$(mimeType)"}`
+
+// put is the implementation of write, the written object is returned if
+// withObject is true.
+func (s *Storage) put(ctx context.Context, path string, r io.Reader, size int64, opt pairStorageWrite,
+	withObject bool) (n int64, o *Object, err error) {
+	ctx, done := s.startOperation(ctx, "write", path)
+	defer func() { done(n, err) }()
+
 	rp := s.getAbsPath(path)
 
-	uploader := qs.NewFormUploader(s.bucket.Cfg)
-	ret := qs.PutRet{}
-	err = uploader.Put(ctx,
-		&ret, s.putPolicy.UploadToken(s.bucket.Mac), rp, r, size, nil)
+	putPolicy := s.putPolicy
+	if opt.HasPutPolicy {
+		if s.tokenFunc != nil {
+			return 0, nil, services.PairUnsupportedError{Pair: WithPutPolicy(opt.PutPolicy)}
+		}
+		if err = opt.PutPolicy.validate(); err != nil {
+			return 0, nil, fmt.Errorf("%w: %v", services.PairUnsupportedError{Pair: WithPutPolicy(opt.PutPolicy)}, err)
+		}
+		putPolicy = s.newPutPolicy(opt.PutPolicy)
+	}
+	if opt.HasStorageClass {
+		if s.tokenFunc != nil {
+			return 0, nil, services.PairUnsupportedError{Pair: WithStorageClass(opt.StorageClass)}
+		}
+		putPolicy.FileType = opt.StorageClass
+	}
+	// Token of bucket scope is insert only, existing objects could only be
+	// overwritten with token of `<bucket>:<key>` scope.
+	if putPolicy.InsertOnly == 0 {
+		putPolicy.Scope = s.name + ":" + rp
+	}
+	if withObject && s.tokenFunc == nil && putPolicy.ReturnBody == "" && putPolicy.CallbackURL == "" {
+		putPolicy.ReturnBody = objectReturnBody
+	}
+
+	partSize := s.writePartSize
+	if opt.HasWritePartSize {
+		if opt.WritePartSize < minWritePartSize || opt.WritePartSize > maxWritePartSize {
+			return 0, nil, services.PairUnsupportedError{Pair: WithWritePartSize(opt.WritePartSize)}
+		}
+		partSize = opt.WritePartSize
+	}
+
+	var sum contentChecksum
+	if opt.HasContentCrc32 {
+		sum.crc32 = &opt.ContentCrc32
+	}
+	if opt.HasContentMd5 {
+		// Content-MD5 is the base64 encoded MD5 of content.
+		sum.md5, err = base64.StdEncoding.DecodeString(opt.ContentMd5)
+		if err != nil || len(sum.md5) != md5.Size {
+			return 0, nil, services.PairUnsupportedError{Pair: ps.WithContentMd5(opt.ContentMd5)}
+		}
+	}
+
+	var opLimiter *rateLimiter
+	if opt.HasRateLimit {
+		if opt.RateLimit <= 0 {
+			return 0, nil, services.PairUnsupportedError{Pair: WithRateLimit(opt.RateLimit)}
+		}
+		opLimiter = newRateLimiter(opt.RateLimit)
+	}
+	ioCallback := limitCallback(ctx, opt.IoCallback, s.writeLimiter, opLimiter)
+
+	if opt.HasSkipUnchanged && opt.SkipUnchanged {
+		rs, ok := r.(io.ReadSeeker)
+		if !ok {
+			// Content is read twice, so it must be seekable.
+			return 0, nil, services.PairUnsupportedError{Pair: WithSkipUnchanged(opt.SkipUnchanged)}
+		}
+		fi, unchanged, err := s.checkUnchanged(ctx, rp, rs, size)
+		if err != nil {
+			return 0, nil, err
+		}
+		if unchanged {
+			if opt.HasPutResult {
+				*opt.PutResult = PutResult{Key: rp, Hash: fi.Hash, Skipped: true}
+			}
+			if withObject {
+				o = s.newObject(true)
+				o.ID = rp
+				o.Path = path
+				o.Mode |= ModeRead
+				setFileInfo(o, fi)
+			}
+			return fi.Fsize, o, nil
+		}
+	}
+
+	h := NewQetagHash()
+	var body json.RawMessage
+	switch {
+	case size == -1 || size > partSize:
+		n, body, err = s.putStream(ctx, rp, r, size, putPolicy, opt.ContentType, partSize, opt.UploadSourceID, ioCallback, h, sum)
+	case size >= 0:
+		n = size
+		body, err = s.putForm(ctx, rp, r, size, putPolicy, opt.ContentType, ioCallback, h, sum)
+	default:
+		err = fmt.Errorf("invalid size %d", size)
+	}
 	if err != nil {
 		return
 	}
-	return size, nil
+
+	var ret struct {
+		qs.PutRet
+		MimeType string `json:"mimeType"`
+	}
+	// Response could be anything if ReturnBody or callback is set, so
+	// we only pick key and hash from it if possible.
+	_ = json.Unmarshal(body, &ret)
+	if ret.Key == "" {
+		ret.Key = rp
+	}
+	// Hash is not verified if it's not responded or not a qetag, which is
+	// the case for parts other than 4MB, and every part has been verified
+	// by Content-MD5 in that case.
+	if isQetag(ret.Hash) && ret.Hash != h.Etag() {
+		err = fmt.Errorf("%w: expect %s, got %s", ErrChecksumMismatch, h.Etag(), ret.Hash)
+		if derr := s.deleteObject(ctx, ret.Key); derr != nil {
+			return n, nil, fmt.Errorf("%w, corrupt object %s remains: %v", err, ret.Key, derr)
+		}
+		return n, nil, fmt.Errorf("%w, corrupt object %s is deleted", err, ret.Key)
+	}
+
+	if opt.HasPutResult {
+		*opt.PutResult = PutResult{
+			Key:  ret.Key,
+			Hash: ret.Hash,
+			Body: body,
+		}
+	}
+
+	if withObject {
+		o = s.newObject(true)
+		o.ID = rp
+		o.Path = path
+		o.Mode |= ModeRead
+		o.SetContentLength(n)
+		if ret.Hash != "" {
+			o.SetEtag(ret.Hash)
+		}
+		if ret.MimeType != "" {
+			o.SetContentType(ret.MimeType)
+		}
+		if s.tokenFunc == nil {
+			var sm ObjectSystemMetadata
+			sm.StorageClass = putPolicy.FileType
+			o.SetSystemMetadata(sm)
+		}
+	}
+	return n, o, nil
 }
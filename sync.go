@@ -0,0 +1,566 @@
+package kodo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	typ "github.com/beyondstorage/go-storage/v4/types"
+)
+
+const defaultSyncConcurrency = 4
+
+// SyncCompareMode decides how a local file is compared with the remote object.
+type SyncCompareMode int
+
+const (
+	// SyncCompareQetag treats a file as unchanged while its size and qetag
+	// are the same as the other side. Objects whose etag is not a qetag are
+	// compared as SyncCompareMtime.
+	SyncCompareQetag SyncCompareMode = iota
+	// SyncCompareMtime treats a file as unchanged while its size is the same
+	// and the destination is not older than the source. It doesn't read the
+	// content, but relies on clocks of both sides.
+	SyncCompareMtime
+)
+
+// Sync operations reported in SyncAction.
+const (
+	SyncOpUpload   = "upload"
+	SyncOpDownload = "download"
+	SyncOpDelete   = "delete"
+)
+
+// SyncOptions is the options of SyncUp and SyncDown.
+type SyncOptions struct {
+	// Concurrency is the count of files transferred at the same time, 4 by default.
+	Concurrency int
+	// CompareMode decides how files are compared, SyncCompareQetag by default.
+	CompareMode SyncCompareMode
+	// DryRun will only report actions to Output without executing them.
+	DryRun bool
+	// DeleteExtraneous will delete files in the destination which don't
+	// exist in the source.
+	DeleteExtraneous bool
+	// Checkpoint is the path of checkpoint file. Finished actions are
+	// recorded into it, and they are skipped while the sync is run again
+	// after interrupted. The file is removed after the sync succeeded.
+	Checkpoint string
+	// Output receives a line for every action, it could be nil.
+	Output io.Writer
+}
+
+// SyncAction is an action executed by sync.
+type SyncAction struct {
+	// Op is one of SyncOpUpload, SyncOpDownload and SyncOpDelete.
+	Op string
+	// Path is the path relative to the synced directory and prefix, which
+	// is separated by `/`.
+	Path string
+	// Size is the size of the file to be transferred, 0 for delete.
+	Size int64
+
+	// mtime is the modified time of source in unix nano, which is used to
+	// tell changed files apart in checkpoint.
+	mtime int64
+	// etag is the qetag of the remote object with the same size as the
+	// local file. The transfer is skipped if qetag of the local file is the
+	// same, which is computed by workers of sync.
+	etag string
+}
+
+// SyncResult is the statistics of a sync.
+type SyncResult struct {
+	// Transferred is the count of files uploaded or downloaded.
+	Transferred int
+	// Deleted is the count of files deleted.
+	Deleted int
+	// Skipped is the count of unchanged files and actions finished in checkpoint.
+	Skipped int
+	// Bytes is the total size of files transferred.
+	Bytes int64
+}
+
+// syncEntry is a file in either side of sync.
+type syncEntry struct {
+	size  int64
+	mtime time.Time
+	etag  string
+}
+
+// SyncUp mirrors files in localDir to objects under prefix, which is
+// relative to the work dir.
+//
+// Errors of storage operations are returned as is, with the action and path
+// of the failed file.
+func (s *Storage) SyncUp(ctx context.Context, localDir, prefix string, opt SyncOptions) (ret SyncResult, err error) {
+	locals, err := walkLocal(localDir)
+	if err != nil {
+		return
+	}
+	remotes, err := s.listRemote(ctx, prefix)
+	if err != nil {
+		return
+	}
+
+	var actions []SyncAction
+	for _, path := range sortedPaths(locals) {
+		src := locals[path]
+		a := SyncAction{Op: SyncOpUpload, Path: path, Size: src.size, mtime: src.mtime.UnixNano()}
+		if dst, ok := remotes[path]; ok {
+			unchanged, etag := opt.compare(src, dst)
+			if unchanged {
+				ret.Skipped++
+				continue
+			}
+			a.etag = etag
+		}
+		actions = append(actions, a)
+	}
+	if opt.DeleteExtraneous {
+		for _, path := range sortedPaths(remotes) {
+			if _, ok := locals[path]; !ok {
+				actions = append(actions, SyncAction{Op: SyncOpDelete, Path: path})
+			}
+		}
+	}
+
+	return s.runSync(ctx, opt, localDir, actions, ret, func(ctx context.Context, a SyncAction) error {
+		remotePath := joinPrefix(prefix, a.Path)
+		if a.Op == SyncOpDelete {
+			return s.DeleteWithContext(ctx, remotePath)
+		}
+
+		f, err := os.Open(filepath.Join(localDir, filepath.FromSlash(a.Path)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = s.WriteWithContext(ctx, remotePath, f, a.Size)
+		return err
+	})
+}
+
+// SyncDown mirrors objects under prefix, which is relative to the work dir,
+// to files in localDir. Modified time of downloaded files is set to the put
+// time of objects.
+func (s *Storage) SyncDown(ctx context.Context, prefix, localDir string, opt SyncOptions) (ret SyncResult, err error) {
+	if err = os.MkdirAll(localDir, 0755); err != nil {
+		return
+	}
+	locals, err := walkLocal(localDir)
+	if err != nil {
+		return
+	}
+	remotes, err := s.listRemote(ctx, prefix)
+	if err != nil {
+		return
+	}
+
+	var actions []SyncAction
+	for _, path := range sortedPaths(remotes) {
+		src := remotes[path]
+		a := SyncAction{Op: SyncOpDownload, Path: path, Size: src.size, mtime: src.mtime.UnixNano()}
+		if dst, ok := locals[path]; ok {
+			unchanged, etag := opt.compare(src, dst)
+			if unchanged {
+				ret.Skipped++
+				continue
+			}
+			a.etag = etag
+		}
+		actions = append(actions, a)
+	}
+	if opt.DeleteExtraneous {
+		for _, path := range sortedPaths(locals) {
+			if _, ok := remotes[path]; !ok {
+				actions = append(actions, SyncAction{Op: SyncOpDelete, Path: path})
+			}
+		}
+	}
+
+	return s.runSync(ctx, opt, localDir, actions, ret, func(ctx context.Context, a SyncAction) error {
+		localPath, err := joinLocal(localDir, a.Path)
+		if err != nil {
+			return err
+		}
+		if a.Op == SyncOpDelete {
+			err := os.Remove(localPath)
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		return s.download(ctx, joinPrefix(prefix, a.Path), localPath, remotes[a.Path].mtime)
+	})
+}
+
+// compare checks whether dst is the same as src without reading content.
+// If qetag of the local file is needed to tell, the qetag of the remote
+// object is returned as etag.
+func (opt SyncOptions) compare(src, dst syncEntry) (unchanged bool, etag string) {
+	if src.size != dst.size {
+		return false, ""
+	}
+	etag = src.etag
+	if etag == "" {
+		etag = dst.etag
+	}
+	if opt.CompareMode == SyncCompareMtime || !isQetag(etag) {
+		return !dst.mtime.Before(src.mtime), ""
+	}
+	return false, etag
+}
+
+// localUnchanged checks whether the local file of a has the qetag of the
+// remote object.
+func localUnchanged(localDir string, a SyncAction) bool {
+	if a.etag == "" {
+		return false
+	}
+	localPath, err := joinLocal(localDir, a.Path)
+	if err != nil {
+		return false
+	}
+	etag, err := fileQetag(localPath)
+	return err == nil && etag == a.etag
+}
+
+// runSync executes actions concurrently, actions finished in checkpoint or
+// of unchanged files are skipped. It stops at the first failure, and the
+// checkpoint is kept so that the sync could be resumed.
+func (s *Storage) runSync(ctx context.Context, opt SyncOptions, localDir string, actions []SyncAction, ret SyncResult,
+	exec func(ctx context.Context, a SyncAction) error) (SyncResult, error) {
+	var cp *syncCheckpoint
+	prefix := ""
+	if opt.DryRun {
+		// Unchanged files are still checked in dry run.
+		prefix = "(dry run) "
+		exec = func(ctx context.Context, a SyncAction) error { return nil }
+	} else {
+		var err error
+		if cp, err = openSyncCheckpoint(opt.Checkpoint); err != nil {
+			return ret, err
+		}
+		defer cp.close()
+	}
+
+	concurrency := opt.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultSyncConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	ch := make(chan SyncAction)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range ch {
+				if localUnchanged(localDir, a) {
+					mu.Lock()
+					ret.Skipped++
+					mu.Unlock()
+					continue
+				}
+
+				err := exec(ctx, a)
+				if err == nil {
+					err = cp.record(a)
+				}
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					if firstErr == nil {
+						firstErr = fmt.Errorf("%s %s: %w", a.Op, a.Path, err)
+						cancel()
+					}
+				case a.Op == SyncOpDelete:
+					ret.Deleted++
+				default:
+					ret.Transferred++
+					ret.Bytes += a.Size
+				}
+				// Output is shared by workers.
+				if err == nil {
+					opt.report(prefix, a)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+loop:
+	for _, a := range actions {
+		if cp.done(a) {
+			mu.Lock()
+			ret.Skipped++
+			mu.Unlock()
+			continue
+		}
+		select {
+		case ch <- a:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return ret, firstErr
+	}
+	return ret, cp.remove()
+}
+
+func (opt SyncOptions) report(prefix string, a SyncAction) {
+	if opt.Output == nil {
+		return
+	}
+	if a.Op == SyncOpDelete {
+		fmt.Fprintf(opt.Output, "%s%s %s\n", prefix, a.Op, a.Path)
+		return
+	}
+	fmt.Fprintf(opt.Output, "%s%s %s (%d bytes)\n", prefix, a.Op, a.Path, a.Size)
+}
+
+// download writes object at path into localPath via a temp file, so that
+// an interrupted download never leaves a broken file.
+func (s *Storage) download(ctx context.Context, path, localPath string, mtime time.Time) error {
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".kodo-sync-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = s.ReadWithContext(ctx, path, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chtimes(f.Name(), mtime, mtime); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), localPath)
+}
+
+// listRemote lists objects under prefix, keyed by path relative to prefix.
+// Directory markers are ignored, and keys escaping from prefix like
+// `../a` are rejected, so that they are never written out of the local dir.
+func (s *Storage) listRemote(ctx context.Context, prefix string) (map[string]syncEntry, error) {
+	it, err := s.ListWithContext(ctx, prefix, ps.WithListMode(typ.ListModePrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]syncEntry)
+	base := joinPrefix(prefix, "")
+	for {
+		o, err := it.Next()
+		if errors.Is(err, typ.IterateDone) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(o.Path, "/") || !strings.HasPrefix(o.Path, base) {
+			continue
+		}
+
+		rel := strings.TrimPrefix(o.Path, base)
+		if clean := path.Clean(rel); path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("unsafe key %s under prefix %s", o.Path, prefix)
+		}
+
+		e := syncEntry{}
+		e.size, _ = o.GetContentLength()
+		e.mtime, _ = o.GetLastModified()
+		e.etag, _ = o.GetEtag()
+		entries[rel] = e
+	}
+}
+
+// walkLocal lists regular files under dir, keyed by path relative to dir
+// separated by `/`. Temp files of download are ignored.
+func walkLocal(dir string) (map[string]syncEntry, error) {
+	entries := make(map[string]syncEntry)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".kodo-sync-") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		entries[filepath.ToSlash(rel)] = syncEntry{size: fi.Size(), mtime: fi.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// joinLocal joins dir and relative path p separated by `/`, and makes sure
+// the result is still under dir.
+func joinLocal(dir, p string) (string, error) {
+	localPath := filepath.Join(dir, filepath.FromSlash(p))
+	rel, err := filepath.Rel(dir, localPath)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", fmt.Errorf("path %s is out of %s", p, dir)
+	}
+	return localPath, nil
+}
+
+// joinPrefix joins prefix and path as a directory.
+func joinPrefix(prefix, path string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix + path
+	}
+	return prefix + "/" + path
+}
+
+func sortedPaths(entries map[string]syncEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for k := range entries {
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func fileQetag(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := NewQetagHash()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return h.Etag(), nil
+}
+
+// syncCheckpoint records finished actions as JSON lines. A nil
+// syncCheckpoint records nothing.
+type syncCheckpoint struct {
+	path     string
+	finished map[SyncAction]bool
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openSyncCheckpoint(path string) (*syncCheckpoint, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	cp := &syncCheckpoint{path: path, finished: make(map[SyncAction]bool)}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// A broken line could be left by a crash, lines after it are ignored.
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var v checkpointLine
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			break
+		}
+		cp.finished[SyncAction{Op: v.Op, Path: v.Path, Size: v.Size, mtime: v.Mtime}] = true
+	}
+	cp.f = f
+	return cp, nil
+}
+
+// checkpointLine is a finished action in checkpoint.
+type checkpointLine struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Mtime int64  `json:"mtime"`
+}
+
+// done checks whether a is finished in the last run. Actions are compared
+// with the size and modified time of source, so that changed files will be
+// transferred again.
+func (cp *syncCheckpoint) done(a SyncAction) bool {
+	if cp == nil {
+		return false
+	}
+	// etag is not recorded in checkpoint.
+	a.etag = ""
+	return cp.finished[a]
+}
+
+func (cp *syncCheckpoint) record(a SyncAction) error {
+	if cp == nil {
+		return nil
+	}
+	data, err := json.Marshal(checkpointLine{Op: a.Op, Path: a.Path, Size: a.Size, Mtime: a.mtime})
+	if err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	_, err = cp.f.Write(append(data, '\n'))
+	return err
+}
+
+func (cp *syncCheckpoint) close() {
+	if cp != nil {
+		_ = cp.f.Close()
+	}
+}
+
+// remove deletes the checkpoint after sync succeeded.
+func (cp *syncCheckpoint) remove() error {
+	if cp == nil {
+		return nil
+	}
+	cp.close()
+	err := os.Remove(cp.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
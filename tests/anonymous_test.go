@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+	"github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestAnonymous(t *testing.T) {
+	srv, store := setupFake(t, ps.WithCredential("anonymous"))
+
+	srv.PutObject(srv.Bucket, "public", []byte("hello"))
+
+	// Private bucket could not be read anonymously.
+	var buf bytes.Buffer
+	_, err := store.Read("public", &buf)
+	if err == nil {
+		t.Errorf("read from private bucket should fail")
+	}
+
+	srv.SetPrivate(srv.Bucket, false)
+
+	buf.Reset()
+	if _, err = store.Read("public", &buf); err != nil || buf.String() != "hello" {
+		t.Errorf("read: %q, %v", buf.String(), err)
+	}
+
+	o, err := store.Stat("public")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if size, _ := o.GetContentLength(); size != 5 {
+		t.Errorf("unexpected content length %d", size)
+	}
+	if etag, _ := o.GetEtag(); etag == "" {
+		t.Errorf("etag should be set")
+	}
+
+	_, err = store.Stat("not-exist")
+	if !errors.Is(err, services.ErrObjectNotExist) {
+		t.Errorf("expect ErrObjectNotExist, got %v", err)
+	}
+
+	_, err = store.Write("public", bytes.NewReader(nil), 0)
+	if !errors.Is(err, services.ErrPermissionDenied) {
+		t.Errorf("write should be denied, got %v", err)
+	}
+	err = store.Delete("public")
+	if !errors.Is(err, services.ErrPermissionDenied) {
+		t.Errorf("delete should be denied, got %v", err)
+	}
+}
+
+func TestTimestampAuthKey(t *testing.T) {
+	srv := setupFakeServer(t)
+
+	srv.PutObject(srv.Bucket, "cdn/object", []byte("hello"))
+	srv.SetTimestampAuthKey("cdn-key")
+
+	newStorager := func(key string) types.Storager {
+		return newFakeStorager(t, srv, ps.WithCredential("anonymous"), kodo.WithTimestampAuthKey(key))
+	}
+
+	var buf bytes.Buffer
+	if _, err := newStorager("cdn-key").Read("cdn/object", &buf); err != nil || buf.String() != "hello" {
+		t.Errorf("read: %q, %v", buf.String(), err)
+	}
+	if _, err := newStorager("wrong-key").Read("cdn/object", &buf); !errors.Is(err, services.ErrPermissionDenied) {
+		t.Errorf("read with wrong key should be denied, got %v", err)
+	}
+}
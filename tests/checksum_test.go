@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func TestQetagHash(t *testing.T) {
+	h := kodo.NewQetagHash()
+	if got := h.Etag(); got != "Fto5o-5ea0sNMlW_75VgGJCv2AcJ" {
+		t.Errorf("unexpected qetag of empty content: %s", got)
+	}
+
+	srv, store := setupFake(t)
+
+	for _, size := range []int{1, 4 * 1024 * 1024, 4*1024*1024 + 1, 9 * 1024 * 1024} {
+		content := make([]byte, size)
+		rand.Read(content)
+		srv.PutObject(srv.Bucket, "a", content)
+
+		o, err := store.Stat("a")
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		etag, _ := o.GetEtag()
+
+		// Write in odd chunks to cross block boundaries.
+		h.Reset()
+		for i := 0; i < size; i += 1000003 {
+			end := i + 1000003
+			if end > size {
+				end = size
+			}
+			h.Write(content[i:end])
+		}
+		if got := h.Etag(); got != etag {
+			t.Errorf("expect qetag %s for %d bytes, got %s", etag, size, got)
+		}
+		if _, err = store.Read("a", ioutil.Discard, kodo.WithVerifyChecksum(true)); err != nil {
+			t.Errorf("verified read of %d bytes: %v", size, err)
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	srv := setupFakeServer(t)
+
+	// The proxy corrupts downloaded content and hash of form upload.
+	target, _ := url.Parse(srv.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return nil
+		}
+		var body []byte
+		switch {
+		case resp.Request.Method == http.MethodGet:
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			data[0]++
+			body = data
+		case resp.Request.Method == http.MethodPost && resp.Request.URL.Path == "/":
+			h := kodo.NewQetagHash()
+			h.Write([]byte("other"))
+			body = []byte(`{"key":"a","hash":"` + h.Etag() + `"}`)
+		default:
+			return nil
+		}
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return nil
+	}
+	proxySrv := httptest.NewServer(proxy)
+	defer proxySrv.Close()
+
+	proxyEndpoint := "http:" + proxySrv.Listener.Addr().String()
+	store := newFakeStorager(t, srv, ps.WithEndpoint(proxyEndpoint), kodo.WithAPIEndpoint(proxyEndpoint))
+
+	content := []byte("hello, checksum")
+	_, err := store.Write("a", bytes.NewReader(content), int64(len(content)))
+	if !errors.Is(err, kodo.ErrChecksumMismatch) {
+		t.Errorf("expect ErrChecksumMismatch for write, got %v", err)
+	}
+	if _, ok := srv.GetObject(srv.Bucket, "a"); ok {
+		t.Error("corrupt object should be deleted")
+	}
+
+	srv.PutObject(srv.Bucket, "a", content)
+	// Content is not verified by default.
+	if _, err = store.Read("a", ioutil.Discard); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	_, err = store.Read("a", ioutil.Discard, kodo.WithVerifyChecksum(true))
+	if !errors.Is(err, kodo.ErrChecksumMismatch) {
+		t.Errorf("expect ErrChecksumMismatch for read, got %v", err)
+	}
+}
+
+func TestChecksumUnverifiable(t *testing.T) {
+	// Hash of object uploaded by parts other than 4MB is not a qetag.
+	srv, store := setupFake(t, kodo.WithWritePartSize(1024*1024))
+
+	content := make([]byte, 2*1024*1024+1234)
+	rand.Read(content)
+	_, err := store.Write("a", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if data, _ := srv.GetObject(srv.Bucket, "a"); !bytes.Equal(data, content) {
+		t.Error("content mismatch")
+	}
+
+	_, err = store.Read("a", ioutil.Discard, kodo.WithVerifyChecksum(true))
+	if !errors.Is(err, kodo.ErrChecksumUnverifiable) {
+		t.Errorf("expect ErrChecksumUnverifiable for read, got %v", err)
+	}
+}
+
+func TestContentCrc32(t *testing.T) {
+	srv, store := setupFake(t, kodo.WithWritePartSize(4*1024*1024))
+
+	var withMD5 int32
+	srv.SetFault(func(r *http.Request) int {
+		if r.Method == http.MethodPut && r.Header.Get("Content-MD5") != "" {
+			atomic.AddInt32(&withMD5, 1)
+		}
+		return 0
+	})
+
+	for _, size := range []int{1000, 8*1024*1024 + 1234} {
+		content := make([]byte, size)
+		rand.Read(content)
+		crc := crc32.ChecksumIEEE(content)
+
+		_, err := store.Write("a", bytes.NewReader(content), int64(size), kodo.WithContentCrc32(crc))
+		if err != nil {
+			t.Errorf("write %d bytes with crc32: %v", size, err)
+		}
+		data, _ := srv.GetObject(srv.Bucket, "a")
+		if !bytes.Equal(data, content) {
+			t.Errorf("content mismatch for %d bytes", size)
+		}
+
+		_, err = store.Write("b", bytes.NewReader(content), int64(size), kodo.WithContentCrc32(crc+1))
+		if !errors.Is(err, kodo.ErrChecksumMismatch) {
+			t.Errorf("expect ErrChecksumMismatch for %d bytes, got %v", size, err)
+		}
+		if _, ok := srv.GetObject(srv.Bucket, "b"); ok {
+			t.Errorf("object of %d bytes with wrong crc32 should not be stored", size)
+		}
+	}
+
+	if atomic.LoadInt32(&withMD5) == 0 {
+		t.Error("expect Content-MD5 sent with parts")
+	}
+}
+
+func TestContentMD5(t *testing.T) {
+	srv, store := setupFake(t, kodo.WithWritePartSize(4*1024*1024))
+
+	for _, size := range []int{1000, 8*1024*1024 + 1234} {
+		content := make([]byte, size)
+		rand.Read(content)
+		sum := md5.Sum(content)
+		contentMD5 := base64.StdEncoding.EncodeToString(sum[:])
+
+		_, err := store.Write("a", bytes.NewReader(content), int64(size), ps.WithContentMd5(contentMD5))
+		if err != nil {
+			t.Errorf("write %d bytes with md5: %v", size, err)
+		}
+		data, _ := srv.GetObject(srv.Bucket, "a")
+		if !bytes.Equal(data, content) {
+			t.Errorf("content mismatch for %d bytes", size)
+		}
+
+		sum[0]++
+		_, err = store.Write("b", bytes.NewReader(content), int64(size),
+			ps.WithContentMd5(base64.StdEncoding.EncodeToString(sum[:])))
+		if !errors.Is(err, kodo.ErrChecksumMismatch) {
+			t.Errorf("expect ErrChecksumMismatch for %d bytes, got %v", size, err)
+		}
+		if _, ok := srv.GetObject(srv.Bucket, "b"); ok {
+			t.Errorf("object of %d bytes with wrong md5 should not be stored", size)
+		}
+	}
+
+	_, err := store.Write("c", bytes.NewReader([]byte("hello")), 5, ps.WithContentMd5("not md5"))
+	if err == nil {
+		t.Error("expect error for invalid md5")
+	}
+}
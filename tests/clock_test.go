@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+)
+
+func TestClockSkew(t *testing.T) {
+	srv := setupFakeServer(t)
+
+	srv.PutObject(srv.Bucket, "skew", []byte("hello"))
+	srv.SetClockSkew(2 * time.Hour)
+
+	var buf bytes.Buffer
+	store := newFakeStorager(t, srv)
+	if _, err := store.Read("skew", &buf); err == nil {
+		t.Errorf("read with skewed clock should fail")
+	}
+	if _, err := store.Read("skew", &buf, kodo.WithURLLifetime(3*3600)); err != nil {
+		t.Errorf("read with longer url lifetime: %v", err)
+	}
+
+	store = newFakeStorager(t, srv, kodo.WithClockSkew(2*3600))
+	if _, err := store.Read("skew", &buf); err != nil {
+		t.Errorf("read with clock skew: %v", err)
+	}
+
+	store = newFakeStorager(t, srv, kodo.WithDetectClockSkew(true))
+	// The first request is rejected, and it's retried with the skew detected
+	// from its response.
+	if _, err := store.Read("skew", &buf); err != nil {
+		t.Errorf("read with detected clock skew: %v", err)
+	}
+	if _, err := store.Stat("skew"); err != nil {
+		t.Errorf("stat with detected clock skew: %v", err)
+	}
+
+	// Configured clock skew is not overwritten by the detected one.
+	srv.SetClockSkew(4 * time.Hour)
+	store = newFakeStorager(t, srv, kodo.WithClockSkew(2*3600), kodo.WithDetectClockSkew(true))
+	for i := 0; i < 2; i++ {
+		if _, err := store.Read("skew", &buf); err == nil {
+			t.Errorf("read %d with wrong configured clock skew should fail", i)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestContextCanceled(t *testing.T) {
+	srv, store := setupFake(t)
+
+	var requests int32
+	srv.SetFault(func(r *http.Request) int {
+		atomic.AddInt32(&requests, 1)
+		return 0
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.StatWithContext(ctx, "object"); !errors.Is(err, context.Canceled) {
+		t.Errorf("stat with canceled context should fail, got %v", err)
+	}
+	it, err := store.ListWithContext(ctx, "", ps.WithListMode(types.ListModePrefix))
+	if err == nil {
+		_, err = it.Next()
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("list with canceled context should fail, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("expect no request sent, got %d", n)
+	}
+
+	// Without api endpoint, region of the bucket is queried from uc, which
+	// must be canceled as well.
+	store2, err := kodo.NewStorager(
+		ps.WithCredential(srv.Credential()),
+		ps.WithName(srv.Bucket),
+		ps.WithEndpoint(srv.Endpoint()),
+	)
+	if err != nil {
+		t.Fatalf("new storager: %v", err)
+	}
+	_, err = store2.StatWithContext(ctx, "object")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expect stat canceled, got %v", err)
+	}
+	_, err = store2.WriteWithContext(ctx, "object", bytes.NewReader([]byte("hello")), 5)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expect write canceled, got %v", err)
+	}
+}
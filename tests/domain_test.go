@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func TestEndpointsFailover(t *testing.T) {
+	srv := setupFakeServer(t)
+
+	srv.PutObject(srv.Bucket, "object", []byte("hello"))
+
+	failed := 0
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	brokenEndpoint := "http:" + strings.TrimPrefix(broken.URL, "http://")
+
+	// Endpoint goes before endpoints, so the broken one is tried first.
+	store := newFakeStorager(t, srv,
+		ps.WithEndpoint(brokenEndpoint),
+		kodo.WithEndpoints([]string{srv.Endpoint()}),
+	)
+
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		var ret kodo.ReadResult
+		if _, err := store.Read("object", &buf, kodo.WithReadResult(&ret)); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if buf.String() != "hello" || ret.Endpoint != srv.URL {
+			t.Errorf("read %q from %s", buf.String(), ret.Endpoint)
+		}
+	}
+	// Broken endpoint is in cooldown after the first failure.
+	if failed != 1 {
+		t.Errorf("broken endpoint should be tried once, got %d", failed)
+	}
+}
@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+func TestResponseError(t *testing.T) {
+	_, store := setupFake(t)
+
+	_, err := store.Stat("not-exist")
+	if !errors.Is(err, services.ErrObjectNotExist) {
+		t.Errorf("expect ErrObjectNotExist for stat, got %v", err)
+	}
+	var re *kodo.ResponseError
+	if !errors.As(err, &re) {
+		t.Fatalf("expect ResponseError, got %v", err)
+	}
+	if re.Code != 612 || re.Message == "" || !strings.HasPrefix(re.RequestID, "kodotest-") || re.Log != "kodotest" {
+		t.Errorf("unexpected response error: %+v", re)
+	}
+
+	var buf bytes.Buffer
+	_, err = store.Read("not-exist", &buf)
+	if !errors.Is(err, services.ErrObjectNotExist) {
+		t.Errorf("expect ErrObjectNotExist for read, got %v", err)
+	}
+	if !errors.As(err, &re) || re.Code != 404 || re.RequestID == "" {
+		t.Errorf("unexpected response error of read: %v", err)
+	}
+}
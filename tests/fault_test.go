@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+func TestRetryWithFault(t *testing.T) {
+	srv, store := setupFake(t, kodo.WithRetryMaxDelay(1))
+
+	srv.PutObject(srv.Bucket, "retry", []byte("hello"))
+
+	var failed int32
+	srv.SetFault(func(r *http.Request) int {
+		if strings.HasPrefix(r.URL.Path, "/stat/") && atomic.AddInt32(&failed, 1) <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	})
+	_, err := store.Stat("retry")
+	if err != nil {
+		t.Fatalf("stat should succeed after retry: %v", err)
+	}
+
+	srv.SetFault(func(r *http.Request) int {
+		return 573
+	})
+	_, err = store.Stat("retry")
+	if !errors.Is(err, services.ErrRequestThrottled) {
+		t.Fatalf("expect ErrRequestThrottled, got %v", err)
+	}
+	var re *kodo.ResponseError
+	if !errors.As(err, &re) || re.RequestID == "" {
+		t.Fatalf("expect ResponseError with request id, got %v", err)
+	}
+
+	srv.SetFault(nil)
+	var buf bytes.Buffer
+	if _, err = store.Read("retry", &buf); err != nil || buf.String() != "hello" {
+		t.Fatalf("read: %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+)
+
+func TestRateLimit(t *testing.T) {
+	const rate = 1024 * 1024
+	_, store := setupFake(t, kodo.WithWriteRateLimit(rate))
+
+	content := make([]byte, rate*3/2)
+	rand.Read(content)
+
+	t.Run("shared by concurrent writes", func(t *testing.T) {
+		start := time.Now()
+		var wg sync.WaitGroup
+		for _, path := range []string{"a", "b"} {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+				_, err := store.Write(path, bytes.NewReader(content), int64(len(content)))
+				if err != nil {
+					t.Errorf("write %s: %v", path, err)
+				}
+			}(path)
+		}
+		wg.Wait()
+
+		// 3MB in total with 1MB burst needs about 2s.
+		if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+			t.Errorf("writes are not throttled, took %v", elapsed)
+		}
+	})
+
+	t.Run("per operation", func(t *testing.T) {
+		start := time.Now()
+		_, err := store.Read("a", ioutil.Discard, kodo.WithRateLimit(rate))
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+
+		// 1.5MB with 1MB burst needs about 0.5s.
+		if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+			t.Errorf("read is not throttled, took %v", elapsed)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := store.Read("a", ioutil.Discard, kodo.WithRateLimit(0))
+		if err == nil {
+			t.Error("expect error for zero rate limit")
+		}
+	})
+}
+
+func TestRequestLimit(t *testing.T) {
+	srv, store := setupFake(t, kodo.WithMetadataQPS(20))
+	srv.PutObject(srv.Bucket, "a", []byte("hello"))
+
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		if _, err := store.Stat("a"); err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+	}
+	// 30 requests with 20 burst needs about 0.5s.
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("requests are not throttled, took %v", elapsed)
+	}
+
+	metadata, data := store.RequestLimitStats()
+	if metadata.Requests != 30 || metadata.Waited == 0 || metadata.WaitTime <= 0 {
+		t.Errorf("unexpected metadata stats: %+v", metadata)
+	}
+	if data != (kodo.RequestLimitStats{}) {
+		t.Errorf("expect empty data stats, got %+v", data)
+	}
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	"github.com/beyondstorage/go-service-kodo/v2/kodotest"
+)
+
+type recordLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordLogger) DebugContext(ctx context.Context, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintln(append([]interface{}{msg}, args...)...))
+}
+
+func TestLogger(t *testing.T) {
+	l := &recordLogger{}
+	srv, store := setupFake(t, kodo.WithLogger(l))
+	srv.SetPrivate(srv.Bucket, true)
+
+	content := bytes.Repeat([]byte("x"), 8*1024*1024)
+	_, err := store.Write("a", bytes.NewReader(content), int64(len(content)), kodo.WithWritePartSize(4*1024*1024))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err = store.Read("a", ioutil.Discard); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if _, err = store.Stat("a"); err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	all := strings.Join(l.logs, "\n")
+	for _, want := range []string{"UpToken REDACTED", "Qiniu REDACTED", "token=REDACTED", "request_id kodotest-"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expect %q in logs:\n%s", want, all)
+		}
+	}
+	if strings.Contains(all, kodotest.AccessKey) || strings.Contains(all, kodotest.SecretKey) {
+		t.Errorf("credential is not redacted in logs:\n%s", all)
+	}
+}
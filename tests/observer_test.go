@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+)
+
+type recordObserver struct {
+	mu      sync.Mutex
+	started []string
+	events  []kodo.OperationEvent
+}
+
+func (o *recordObserver) Start(ctx context.Context, op, path string) context.Context {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, op)
+	return ctx
+}
+
+func (o *recordObserver) Finish(ctx context.Context, ev kodo.OperationEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, ev)
+}
+
+func (o *recordObserver) last() kodo.OperationEvent {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.events[len(o.events)-1]
+}
+
+func TestObserver(t *testing.T) {
+	var counts sync.Map
+	o := &recordObserver{}
+	srv, store := setupFake(t,
+		kodo.WithRetryMaxDelay(1),
+		kodo.WithObserver(kodo.MultiObserver(o, kodo.MetricsObserver{
+			Count: func(op, errorClass string) {
+				counts.Store(op+"/"+errorClass, true)
+			},
+		})),
+	)
+
+	content := []byte("hello, observer")
+	_, err := store.Write("a", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	ev := o.last()
+	if ev.Op != "write" || ev.Path != "a" || ev.Bytes != int64(len(content)) || ev.Err != nil || ev.RequestID == "" {
+		t.Errorf("unexpected write event: %+v", ev)
+	}
+
+	var failed int32
+	srv.SetFault(func(r *http.Request) int {
+		if r.Method == http.MethodGet && atomic.AddInt32(&failed, 1) == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	})
+	if _, err = store.Read("a", ioutil.Discard); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	srv.SetFault(nil)
+	ev = o.last()
+	if ev.Op != "read" || ev.Bytes != int64(len(content)) || ev.Retries != 1 {
+		t.Errorf("unexpected read event: %+v", ev)
+	}
+
+	_, err = store.Stat("not-exist")
+	if err == nil {
+		t.Fatal("expect error for not existing object")
+	}
+	ev = o.last()
+	if ev.Op != "stat" || ev.ErrorClass != kodo.ErrorClassObjectNotExist || !strings.HasPrefix(ev.RequestID, "kodotest-") {
+		t.Errorf("unexpected stat event: %+v", ev)
+	}
+
+	for _, key := range []string{"write/", "read/", "stat/" + kodo.ErrorClassObjectNotExist} {
+		if _, ok := counts.Load(key); !ok {
+			t.Errorf("metrics of %s is not counted", key)
+		}
+	}
+	if len(o.started) != len(o.events) {
+		t.Errorf("expect %d started, got %d", len(o.events), len(o.started))
+	}
+
+	// Nested operations are not notified.
+	for _, tt := range []struct {
+		op string
+		fn func() error
+	}{
+		{"read", func() error {
+			_, err := store.Read("a", ioutil.Discard, kodo.WithVerifyChecksum(true))
+			return err
+		}},
+		{"open", func() error {
+			_, err := store.Open("a")
+			return err
+		}},
+	} {
+		o.mu.Lock()
+		o.started, o.events = nil, nil
+		o.mu.Unlock()
+
+		if err = tt.fn(); err != nil {
+			t.Fatalf("%s: %v", tt.op, err)
+		}
+		if len(o.started) != 1 || len(o.events) != 1 || o.events[0].Op != tt.op {
+			t.Errorf("expect only %s notified, got %v", tt.op, o.started)
+		}
+	}
+}
+
+func TestTracingObserverWithoutStartSpan(t *testing.T) {
+	srv, store := setupFake(t, kodo.WithObserver(kodo.TracingObserver{}))
+	srv.PutObject(srv.Bucket, "a", []byte("hello"))
+
+	if _, err := store.Read("a", ioutil.Discard); err != nil {
+		t.Errorf("read: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+func TestPutPolicy(t *testing.T) {
+	srv, store := setupFake(t,
+		kodo.WithPutPolicy(kodo.PutPolicy{
+			FsizeLimit: 4,
+			ReturnBody: `{"key":"$(key)","hash":"$(hash)","size":$(fsize)}`,
+		}),
+	)
+
+	var callbackBody string
+	cb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		callbackBody = string(bs)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer cb.Close()
+
+	var ret kodo.PutResult
+	_, err := store.Write("small", bytes.NewReader([]byte("abc")), 3, kodo.WithPutResult(&ret))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if ret.Key != "small" || ret.Hash == "" || !bytes.Contains(ret.Body, []byte(`"size":3`)) {
+		t.Errorf("unexpected put result: %+v, %s", ret, ret.Body)
+	}
+
+	_, err = store.Write("large", bytes.NewReader([]byte("abcde")), 5)
+	if err == nil {
+		t.Errorf("write larger than fsize limit should fail")
+	}
+
+	// Put policy in write replaces the one in storage.
+	_, err = store.Write("callback", bytes.NewReader([]byte("abcde")), 5,
+		kodo.WithPutPolicy(kodo.PutPolicy{
+			CallbackURL:  cb.URL,
+			CallbackBody: "key=$(key)&size=$(fsize)",
+		}),
+		kodo.WithPutResult(&ret))
+	if err != nil {
+		t.Fatalf("write with callback: %v", err)
+	}
+	if string(ret.Body) != `{"ok":true}` || ret.Key != "callback" {
+		t.Errorf("unexpected put result: %+v, %s", ret, ret.Body)
+	}
+	if callbackBody != "key=callback&size=5" {
+		t.Errorf("unexpected callback body: %s", callbackBody)
+	}
+
+	_, err = store.Write("invalid", bytes.NewReader(nil), 0,
+		kodo.WithPutPolicy(kodo.PutPolicy{CallbackBody: "key=$(key)"}))
+	if !errors.Is(err, services.ErrCapabilityInsufficient) || !strings.Contains(err.Error(), "callback url is required") {
+		t.Errorf("expect invalid put policy rejected, got %v", err)
+	}
+
+	_, err = kodo.NewStorager(
+		ps.WithCredential(srv.Credential()),
+		ps.WithName(srv.Bucket),
+		ps.WithEndpoint(srv.Endpoint()),
+		kodo.WithPutPolicy(kodo.PutPolicy{FsizeMin: 10, FsizeLimit: 5}),
+	)
+	if !errors.Is(err, services.ErrCapabilityInsufficient) || !strings.Contains(err.Error(), "less than fsize min") {
+		t.Errorf("expect invalid put policy of storager rejected, got %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	"github.com/beyondstorage/go-service-kodo/v2/kodotest"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/types"
+)
+
+func TestParallelRead(t *testing.T) {
+	srv, store := setupFake(t,
+		kodo.WithRetryMaxDelay(1),
+		kodo.WithReadConcurrency(4),
+		kodo.WithReadPartSize(1000),
+	)
+
+	content := make([]byte, 10000)
+	rand.Read(content)
+	srv.PutObject(srv.Bucket, "large", content)
+
+	// Every range request fails once, so that parts must be retried.
+	var mu sync.Mutex
+	failed := make(map[string]bool)
+	srv.SetFault(func(r *http.Request) int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		rg := r.Header.Get("Range")
+		if rg == "" || failed[rg] {
+			return 0
+		}
+		failed[rg] = true
+		return http.StatusServiceUnavailable
+	})
+
+	cases := []struct {
+		name   string
+		pairs  []types.Pair
+		expect []byte
+	}{
+		{"whole", nil, content},
+		{"offset", []types.Pair{ps.WithOffset(1234)}, content[1234:]},
+		{"offset and size", []types.Pair{ps.WithOffset(1234), ps.WithSize(5678)}, content[1234 : 1234+5678]},
+		{"sequential", []types.Pair{ps.WithOffset(100), ps.WithSize(200), kodo.WithReadConcurrency(1)}, content[100:300]},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := store.Read("large", &buf, tt.pairs...)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if n != int64(len(tt.expect)) || !bytes.Equal(buf.Bytes(), tt.expect) {
+				t.Errorf("read %d bytes, content mismatch", n)
+			}
+		})
+	}
+}
+
+func TestReadRangeIgnored(t *testing.T) {
+	srv := setupFakeServer(t)
+
+	content := make([]byte, 10000)
+	rand.Read(content)
+	srv.PutObject(srv.Bucket, "large", content)
+
+	// The domain ignores Range and always responds the whole content.
+	domain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Range")
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer domain.Close()
+
+	store := newFakeStorager(t, srv, ps.WithEndpoint("http:"+domain.Listener.Addr().String()))
+
+	cases := []struct {
+		name   string
+		pairs  []types.Pair
+		expect []byte
+	}{
+		{"sequential", []types.Pair{ps.WithOffset(100), ps.WithSize(200)}, content[100:300]},
+		{"sequential offset", []types.Pair{ps.WithOffset(1234)}, content[1234:]},
+		{"parallel", []types.Pair{ps.WithOffset(100), ps.WithSize(2000), kodo.WithReadConcurrency(4), kodo.WithReadPartSize(1000)}, content[100:2100]},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := store.Read("large", &buf, tt.pairs...)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if n != int64(len(tt.expect)) || !bytes.Equal(buf.Bytes(), tt.expect) {
+				t.Errorf("read %d bytes, content mismatch", n)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	srv, store := setupFake(t)
+
+	content := make([]byte, 300*1024)
+	rand.Read(content)
+	srv.PutObject(srv.Bucket, "random", content)
+
+	r, err := store.Open("random")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if r.Size() != int64(len(content)) {
+		t.Errorf("unexpected size %d", r.Size())
+	}
+
+	p := make([]byte, 100)
+	if n, err := r.ReadAt(p, 1000); err != nil || n != 100 || !bytes.Equal(p, content[1000:1100]) {
+		t.Errorf("read at: %d, %v", n, err)
+	}
+	if n, err := r.ReadAt(p, int64(len(content))-10); err != io.EOF || n != 10 {
+		t.Errorf("read at the end: %d, %v", n, err)
+	}
+	if n, err := r.ReadAt(p[:0], 1000); err != nil || n != 0 {
+		t.Errorf("read at with empty buffer: %d, %v", n, err)
+	}
+
+	if _, err = r.Seek(-1000, io.SeekEnd); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(data, content[len(content)-1000:]) {
+		t.Errorf("read after seek: %d bytes, %v", len(data), err)
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	data, err = ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("read all: %d bytes, %v", len(data), err)
+	}
+
+	// Reading an overwritten object fails.
+	srv.PutObject(srv.Bucket, "random", []byte("changed"))
+	if _, err = r.ReadAt(p[:1], 0); err == nil {
+		t.Errorf("read overwritten object should fail")
+	}
+
+	if err = r.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if _, err = r.Read(p); err == nil {
+		t.Errorf("read after close should fail")
+	}
+}
+
+func TestResumeRead(t *testing.T) {
+	srv, store := setupFake(t)
+
+	content := make([]byte, 100000)
+	rand.Read(content)
+	srv.PutObject(srv.Bucket, "object", content)
+
+	// Every download is interrupted after 30000 bytes.
+	var mu sync.Mutex
+	var ranges []string
+	srv.SetInterrupt(func(r *http.Request) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+
+		ranges = append(ranges, r.Header.Get("Range"))
+		return 30000
+	})
+
+	var buf bytes.Buffer
+	_, err := store.Read("object", &buf, kodo.WithReadResumeAttempts(1))
+	if err == nil {
+		t.Errorf("read should fail after resume attempts exhausted")
+	}
+	if buf.Len() != 60000 {
+		t.Errorf("expect 60000 bytes before failure, got %d", buf.Len())
+	}
+
+	ranges = nil
+	buf.Reset()
+	n, err := store.Read("object", &buf, kodo.WithReadResumeAttempts(5))
+	if err != nil || n != int64(len(content)) || !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("read with resume: %d, %v", n, err)
+	}
+	expect := []string{"", "bytes=30000-", "bytes=60000-", "bytes=90000-"}
+	if len(ranges) != len(expect) {
+		t.Fatalf("unexpected ranges: %v", ranges)
+	}
+	for i := range expect {
+		if ranges[i] != expect[i] {
+			t.Errorf("unexpected ranges: %v", ranges)
+		}
+	}
+}
+
+// newIfMatchIgnoredStorager returns a storager whose download domain
+// ignores If-Match like some cdn domains.
+func newIfMatchIgnoredStorager(t *testing.T, srv *kodotest.Server, pairs ...types.Pair) *kodo.Storage {
+	domain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("If-Match")
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(domain.Close)
+
+	pairs = append(pairs, ps.WithEndpoint("http:"+domain.Listener.Addr().String()))
+	return newFakeStorager(t, srv, pairs...)
+}
+
+func TestResumeReadChanged(t *testing.T) {
+	srv := setupFakeServer(t)
+	store := newIfMatchIgnoredStorager(t, srv)
+
+	content := make([]byte, 100000)
+	rand.Read(content)
+	srv.PutObject(srv.Bucket, "object", content)
+
+	// The object is overwritten after the first download is interrupted.
+	changed := make([]byte, len(content))
+	rand.Read(changed)
+	var once sync.Once
+	srv.SetInterrupt(func(r *http.Request) int64 {
+		cut := int64(0)
+		once.Do(func() {
+			srv.PutObject(srv.Bucket, "object", changed)
+			cut = 30000
+		})
+		return cut
+	})
+
+	var buf bytes.Buffer
+	_, err := store.Read("object", &buf)
+	if err == nil {
+		t.Errorf("read should fail while the object is changed")
+	}
+	if buf.Len() != 30000 {
+		t.Errorf("expect 30000 bytes before failure, got %d", buf.Len())
+	}
+}
+
+func TestParallelReadChanged(t *testing.T) {
+	srv := setupFakeServer(t)
+	store := newIfMatchIgnoredStorager(t, srv,
+		kodo.WithReadConcurrency(4),
+		kodo.WithReadPartSize(1000),
+	)
+
+	content := make([]byte, 10000)
+	rand.Read(content)
+	srv.PutObject(srv.Bucket, "large", content)
+
+	// The object is overwritten while the first part is being downloaded.
+	changed := make([]byte, len(content))
+	rand.Read(changed)
+	var once sync.Once
+	srv.SetInterrupt(func(r *http.Request) int64 {
+		once.Do(func() {
+			srv.PutObject(srv.Bucket, "large", changed)
+		})
+		return 0
+	})
+
+	var buf bytes.Buffer
+	_, err := store.Read("large", &buf)
+	if err == nil {
+		t.Errorf("read should fail while the object is changed")
+	}
+	if buf.Len() != 1000 {
+		t.Errorf("expect the first part before failure, got %d bytes", buf.Len())
+	}
+}
+
+func TestOpenChanged(t *testing.T) {
+	srv := setupFakeServer(t)
+	store := newIfMatchIgnoredStorager(t, srv)
+
+	srv.PutObject(srv.Bucket, "object", []byte("hello"))
+
+	r, err := store.Open("object")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer r.Close()
+
+	srv.PutObject(srv.Bucket, "object", []byte("world"))
+	p := make([]byte, 5)
+	if _, err = r.ReadAt(p, 0); err == nil {
+		t.Errorf("read overwritten object should fail, got %q", p)
+	}
+}
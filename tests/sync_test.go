@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+)
+
+func writeLocalFiles(t *testing.T, dir string, files map[string]string) {
+	for path, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	srv, s := setupFake(t)
+	ctx := context.Background()
+
+	local := t.TempDir()
+	writeLocalFiles(t, local, map[string]string{
+		"a.txt":     "hello",
+		"sub/b.txt": "world",
+	})
+	srv.PutObject(srv.Bucket, "backup/extra.txt", []byte("extra"))
+
+	ret, err := s.SyncUp(ctx, local, "backup", kodo.SyncOptions{DeleteExtraneous: true})
+	if err != nil {
+		t.Fatalf("sync up: %v", err)
+	}
+	if ret.Transferred != 2 || ret.Deleted != 1 || ret.Bytes != 10 {
+		t.Errorf("unexpected result: %+v", ret)
+	}
+	if data, _ := srv.GetObject(srv.Bucket, "backup/sub/b.txt"); string(data) != "world" {
+		t.Errorf("unexpected content %q", data)
+	}
+	if _, ok := srv.GetObject(srv.Bucket, "backup/extra.txt"); ok {
+		t.Error("extraneous object should be deleted")
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		writeLocalFiles(t, local, map[string]string{"a.txt": "hello!"})
+
+		var out bytes.Buffer
+		ret, err := s.SyncUp(ctx, local, "backup", kodo.SyncOptions{DryRun: true, Output: &out})
+		if err != nil {
+			t.Fatalf("sync up: %v", err)
+		}
+		if ret.Transferred != 1 || ret.Skipped != 1 {
+			t.Errorf("unexpected result: %+v", ret)
+		}
+		if out.String() != "(dry run) upload a.txt (6 bytes)\n" {
+			t.Errorf("unexpected output %q", out.String())
+		}
+		if data, _ := srv.GetObject(srv.Bucket, "backup/a.txt"); string(data) != "hello" {
+			t.Error("object should not be changed in dry run")
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		down := t.TempDir()
+		writeLocalFiles(t, down, map[string]string{"stale.txt": "stale"})
+
+		ret, err := s.SyncDown(ctx, "backup/", down, kodo.SyncOptions{DeleteExtraneous: true})
+		if err != nil {
+			t.Fatalf("sync down: %v", err)
+		}
+		if ret.Transferred != 2 || ret.Deleted != 1 {
+			t.Errorf("unexpected result: %+v", ret)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(down, "sub", "b.txt"))
+		if err != nil || string(data) != "world" {
+			t.Errorf("unexpected content %q: %v", data, err)
+		}
+		if _, err = os.Stat(filepath.Join(down, "stale.txt")); !os.IsNotExist(err) {
+			t.Error("extraneous file should be deleted")
+		}
+
+		ret, err = s.SyncDown(ctx, "backup/", down, kodo.SyncOptions{CompareMode: kodo.SyncCompareMtime})
+		if err != nil {
+			t.Fatalf("sync down: %v", err)
+		}
+		if ret.Transferred != 0 || ret.Skipped != 2 {
+			t.Errorf("expect all files skipped by mtime, got %+v", ret)
+		}
+	})
+
+	t.Run("checkpoint", func(t *testing.T) {
+		local := t.TempDir()
+		writeLocalFiles(t, local, map[string]string{"1": "1", "2": "2", "3": "3"})
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+		var uploads int32
+		failAt := int32(2)
+		srv.SetFault(func(r *http.Request) int {
+			if r.Method == http.MethodPost && r.URL.Path == "/" {
+				if atomic.AddInt32(&uploads, 1) == atomic.LoadInt32(&failAt) {
+					return http.StatusBadRequest
+				}
+			}
+			return 0
+		})
+		defer srv.SetFault(nil)
+
+		opt := kodo.SyncOptions{Concurrency: 1, Checkpoint: checkpoint}
+		_, err := s.SyncUp(ctx, local, "cp", opt)
+		if err == nil || !strings.Contains(err.Error(), "upload 2") {
+			t.Fatalf("expect upload of 2 failed, got %v", err)
+		}
+
+		// Remove the object uploaded, so that it's only skipped by checkpoint.
+		if err = s.Delete("cp/1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		atomic.StoreInt32(&failAt, 0)
+		atomic.StoreInt32(&uploads, 0)
+		ret, err := s.SyncUp(ctx, local, "cp", opt)
+		if err != nil {
+			t.Fatalf("resume sync up: %v", err)
+		}
+		if ret.Transferred != 2 || ret.Skipped != 1 || atomic.LoadInt32(&uploads) != 2 {
+			t.Errorf("unexpected result of resumed sync: %+v", ret)
+		}
+		if _, err = os.Stat(checkpoint); !os.IsNotExist(err) {
+			t.Error("checkpoint should be removed after sync succeeded")
+		}
+	})
+}
+
+func TestSyncOutput(t *testing.T) {
+	_, s := setupFake(t)
+
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("%02d", i)] = "hello"
+	}
+	local := t.TempDir()
+	writeLocalFiles(t, local, files)
+
+	// Actions are reported by concurrent workers.
+	var out bytes.Buffer
+	ret, err := s.SyncUp(context.Background(), local, "backup", kodo.SyncOptions{Concurrency: 4, Output: &out})
+	if err != nil {
+		t.Fatalf("sync up: %v", err)
+	}
+	if ret.Transferred != len(files) {
+		t.Errorf("unexpected result: %+v", ret)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	sort.Strings(lines)
+	for i, line := range lines {
+		if expect := fmt.Sprintf("upload %02d (5 bytes)", i); line != expect {
+			t.Errorf("expect line %q, got %q", expect, line)
+		}
+	}
+	if len(lines) != len(files) {
+		t.Errorf("expect %d lines, got %d", len(files), len(lines))
+	}
+}
+
+func TestSyncDownUnsafeKey(t *testing.T) {
+	srv, s := setupFake(t)
+	srv.PutObject(srv.Bucket, "backup/../evil.txt", []byte("evil"))
+
+	dir := t.TempDir()
+	down := filepath.Join(dir, "down")
+	_, err := s.SyncDown(context.Background(), "backup/", down, kodo.SyncOptions{})
+	if err == nil || !strings.Contains(err.Error(), "unsafe key") {
+		t.Errorf("expect error for unsafe key, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("file should not be written out of local dir: %v", err)
+	}
+}
+
+func TestSyncNotQetag(t *testing.T) {
+	srv, s := setupFake(t)
+	ctx := context.Background()
+
+	content := make([]byte, 2*1024*1024+1234)
+	rand.Read(content)
+	local := t.TempDir()
+	localPath := filepath.Join(local, "a")
+	if err := ioutil.WriteFile(localPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(localPath, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hash of object uploaded by parts other than 4MB is not a qetag.
+	_, err := newFakeStorager(t, srv, kodo.WithWritePartSize(1024*1024)).
+		Write("backup/a", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// The object is newer than the local file, so it's unchanged by mtime.
+	ret, err := s.SyncUp(ctx, local, "backup", kodo.SyncOptions{})
+	if err != nil {
+		t.Fatalf("sync up: %v", err)
+	}
+	if ret.Transferred != 0 || ret.Skipped != 1 {
+		t.Errorf("expect object without qetag skipped by mtime, got %+v", ret)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if err = os.Chtimes(localPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	ret, err = s.SyncUp(ctx, local, "backup", kodo.SyncOptions{})
+	if err != nil {
+		t.Fatalf("sync up: %v", err)
+	}
+	if ret.Transferred != 1 || ret.Skipped != 0 {
+		t.Errorf("expect newer file uploaded, got %+v", ret)
+	}
+}
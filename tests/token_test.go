@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/qiniu/go-sdk/v7/auth/qbox"
+	qs "github.com/qiniu/go-sdk/v7/storage"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	"github.com/beyondstorage/go-service-kodo/v2/kodotest"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+	"github.com/beyondstorage/go-storage/v4/services"
+)
+
+func TestUploadTokenOnly(t *testing.T) {
+	srv := setupFakeServer(t)
+
+	mac := qbox.NewMac(kodotest.AccessKey, kodotest.SecretKey)
+	calls := 0
+	tokenFunc := func(ctx context.Context) (string, error) {
+		calls++
+		p := qs.PutPolicy{Scope: srv.Bucket, Expires: 60}
+		return p.UploadToken(mac), nil
+	}
+
+	store, err := kodo.NewStorager(
+		ps.WithName(srv.Bucket),
+		ps.WithEndpoint(srv.Endpoint()),
+		kodo.WithAPIEndpoint(srv.Endpoint()),
+		kodo.WithUploadTokenFunc(tokenFunc),
+	)
+	if err != nil {
+		t.Fatalf("new storager: %v", err)
+	}
+
+	_, err = store.Write("edge", bytes.NewReader([]byte("hello")), 5)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if data, ok := srv.GetObject(srv.Bucket, "edge"); !ok || string(data) != "hello" {
+		t.Errorf("object is not written: %q", data)
+	}
+	if calls != 1 {
+		t.Errorf("token func should be called once, got %d", calls)
+	}
+
+	// Token of bucket scope could only overwrite with the same content.
+	if _, err = store.Write("edge", bytes.NewReader([]byte("hello")), 5); err != nil {
+		t.Errorf("write the same content: %v", err)
+	}
+	if _, err = store.Write("edge", bytes.NewReader([]byte("world")), 5); err == nil {
+		t.Errorf("overwrite with bucket scope token should fail")
+	}
+	if data, _ := srv.GetObject(srv.Bucket, "edge"); string(data) != "hello" {
+		t.Errorf("object should not be overwritten: %q", data)
+	}
+
+	_, err = store.Stat("edge")
+	if !errors.Is(err, services.ErrPermissionDenied) {
+		t.Errorf("stat should be denied, got %v", err)
+	}
+	err = store.Delete("edge")
+	if !errors.Is(err, services.ErrPermissionDenied) {
+		t.Errorf("delete should be denied, got %v", err)
+	}
+
+	_, err = kodo.NewStorager(
+		ps.WithName(srv.Bucket),
+		ps.WithEndpoint(srv.Endpoint()),
+	)
+	if !errors.Is(err, services.ErrRestrictionDissatisfied) {
+		t.Errorf("storager without credential and upload token should fail, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func TestSkipUnchanged(t *testing.T) {
+	srv, store := setupFake(t)
+
+	var uploads int32
+	srv.SetFault(func(r *http.Request) int {
+		if r.Method == http.MethodPost && r.URL.Path == "/" {
+			atomic.AddInt32(&uploads, 1)
+		}
+		return 0
+	})
+
+	content := make([]byte, 1000)
+	rand.Read(content)
+
+	write := func(content []byte) kodo.PutResult {
+		var ret kodo.PutResult
+		n, err := store.Write("a", bytes.NewReader(content), int64(len(content)),
+			kodo.WithSkipUnchanged(true), kodo.WithPutResult(&ret))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if n != int64(len(content)) {
+			t.Errorf("expect %d bytes, got %d", len(content), n)
+		}
+		return ret
+	}
+
+	if ret := write(content); ret.Skipped {
+		t.Error("write of new object should not be skipped")
+	}
+	if ret := write(content); !ret.Skipped || ret.Hash == "" {
+		t.Errorf("write of unchanged content should be skipped: %+v", ret)
+	}
+	if atomic.LoadInt32(&uploads) != 1 {
+		t.Errorf("expect 1 upload, got %d", uploads)
+	}
+
+	changed := append([]byte{}, content...)
+	changed[0]++
+	if ret := write(changed); ret.Skipped {
+		t.Error("write of changed content should not be skipped")
+	}
+	if data, _ := srv.GetObject(srv.Bucket, "a"); !bytes.Equal(data, changed) {
+		t.Error("content mismatch")
+	}
+
+	r := struct{ io.Reader }{bytes.NewReader(content)}
+	_, err := store.Write("a", r, int64(len(content)), kodo.WithSkipUnchanged(true))
+	if err == nil {
+		t.Error("expect error for reader which could not be seeked")
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	srv, store := setupFake(t)
+
+	content := []byte("hello, unchanged")
+	h := kodo.NewQetagHash()
+	h.Write(content)
+	srv.PutObject(srv.Bucket, "same", content)
+	srv.PutObject(srv.Bucket, "changed", []byte("hello, changed!!"))
+
+	unchanged, err := store.Unchanged([]kodo.LocalObject{
+		{Path: "same", Size: int64(len(content)), Etag: h.Etag()},
+		{Path: "changed", Size: int64(len(content)), Etag: h.Etag()},
+		{Path: "not-exist", Size: int64(len(content)), Etag: h.Etag()},
+	})
+	if err != nil {
+		t.Fatalf("unchanged: %v", err)
+	}
+	if expect := []bool{true, false, false}; !reflect.DeepEqual(unchanged, expect) {
+		t.Errorf("expect %v, got %v", expect, unchanged)
+	}
+}
+
+func TestUnchangedFailed(t *testing.T) {
+	// Stat in batch fails for every object of a bucket not existing.
+	_, store := setupFake(t, ps.WithName("not-exist-bucket"))
+
+	_, err := store.Unchanged([]kodo.LocalObject{{Path: "a"}})
+	if err == nil {
+		t.Fatal("expect error for failed stat in batch")
+	}
+	var respErr *kodo.ResponseError
+	if !errors.As(err, &respErr) || respErr.Code == http.StatusOK {
+		t.Errorf("expect response error, got %v", err)
+	}
+}
+
+func TestUnchangedNotQetag(t *testing.T) {
+	srv := setupFakeServer(t)
+
+	// Hash of object uploaded by parts other than 4MB is not a qetag.
+	content := make([]byte, 2*1024*1024+1234)
+	rand.Read(content)
+	_, err := newFakeStorager(t, srv, kodo.WithWritePartSize(1024*1024)).
+		Write("a", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	store := newFakeStorager(t, srv)
+	h := kodo.NewQetagHash()
+	h.Write(content)
+	unchanged, err := store.Unchanged([]kodo.LocalObject{
+		{Path: "a", Size: int64(len(content)), Etag: h.Etag()},
+	})
+	if err != nil {
+		t.Fatalf("unchanged: %v", err)
+	}
+	if unchanged[0] {
+		t.Error("object without qetag should be changed")
+	}
+
+	var ret kodo.PutResult
+	_, err = store.Write("a", bytes.NewReader(content), int64(len(content)),
+		kodo.WithSkipUnchanged(true), kodo.WithPutResult(&ret))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if ret.Skipped || ret.Hash != h.Etag() {
+		t.Errorf("object without qetag should be uploaded again: %+v", ret)
+	}
+}
@@ -7,11 +7,16 @@ import (
 	"github.com/google/uuid"
 
 	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	"github.com/beyondstorage/go-service-kodo/v2/kodotest"
 	ps "github.com/beyondstorage/go-storage/v4/pairs"
 	"github.com/beyondstorage/go-storage/v4/types"
 )
 
 func setupTest(t *testing.T) types.Storager {
+	if os.Getenv("STORAGE_KODO_INTEGRATION_TEST") != "on" {
+		return setupFakeTest(t)
+	}
+
 	t.Log("Setup test for kodo")
 
 	store, err := kodo.NewStorager(
@@ -28,3 +33,45 @@ func setupTest(t *testing.T) types.Storager {
 	}
 	return store
 }
+
+func setupFakeTest(t *testing.T) types.Storager {
+	t.Log("Setup test for fake kodo")
+
+	_, store := setupFake(t,
+		ps.WithWorkDir("/"+uuid.New().String()+"/"),
+		kodo.WithStorageFeatures(kodo.StorageFeatures{
+			VirtualDir: true,
+		}),
+	)
+	return store
+}
+
+// setupFake starts a fake kodo server and creates a storager of its bucket
+// with pairs.
+func setupFake(t *testing.T, pairs ...types.Pair) (*kodotest.Server, *kodo.Storage) {
+	srv := setupFakeServer(t)
+	return srv, newFakeStorager(t, srv, pairs...)
+}
+
+// setupFakeServer starts a fake kodo server, which is closed after the test.
+func setupFakeServer(t *testing.T) *kodotest.Server {
+	srv := kodotest.NewServer("test-bucket")
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newFakeStorager creates a storager of the bucket in srv. The first pair
+// of a key wins, so pairs could override the default credential and
+// endpoints.
+func newFakeStorager(t *testing.T, srv *kodotest.Server, pairs ...types.Pair) *kodo.Storage {
+	store, err := kodo.NewStorager(append(pairs,
+		ps.WithCredential(srv.Credential()),
+		ps.WithName(srv.Bucket),
+		ps.WithEndpoint(srv.Endpoint()),
+		kodo.WithAPIEndpoint(srv.Endpoint()),
+	)...)
+	if err != nil {
+		t.Fatalf("new storager: %v", err)
+	}
+	return store.(*kodo.Storage)
+}
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	kodo "github.com/beyondstorage/go-service-kodo/v2"
+	ps "github.com/beyondstorage/go-storage/v4/pairs"
+)
+
+func TestWriteUnknownSize(t *testing.T) {
+	srv, store := setupFake(t, kodo.WithWritePartSize(4*1024*1024))
+
+	for _, size := range []int{0, 1000, 4 * 1024 * 1024, 8*1024*1024 + 1234} {
+		content := make([]byte, size)
+		rand.Read(content)
+
+		// Hide the Seeker of bytes.Reader, so that the size is unknown.
+		r := struct{ io.Reader }{bytes.NewReader(content)}
+
+		var ret kodo.PutResult
+		n, err := store.Write("stream", r, -1, kodo.WithPutResult(&ret))
+		if err != nil {
+			t.Fatalf("write %d bytes: %v", size, err)
+		}
+		if n != int64(size) {
+			t.Errorf("expect %d bytes written, got %d", size, n)
+		}
+		if ret.Key != "stream" || ret.Hash == "" {
+			t.Errorf("unexpected put result: %+v", ret)
+		}
+
+		data, ok := srv.GetObject(srv.Bucket, "stream")
+		if !ok || !bytes.Equal(data, content) {
+			t.Errorf("content mismatch for %d bytes", size)
+		}
+	}
+}
+
+func TestWriteShortReader(t *testing.T) {
+	srv, store := setupFake(t, kodo.WithWritePartSize(1024*1024))
+
+	// The reader is shorter than the declared size, which is larger than the
+	// part size.
+	for _, size := range []int{1000, 1024*1024 + 1234} {
+		content := make([]byte, size)
+		rand.Read(content)
+		r := struct{ io.Reader }{bytes.NewReader(content)}
+
+		_, err := store.Write("short", r, 3*1024*1024)
+		if err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+			t.Errorf("expect unexpected EOF for %d bytes, got %v", size, err)
+		}
+		if _, ok := srv.GetObject(srv.Bucket, "short"); ok {
+			t.Errorf("partial content of %d bytes should not be stored", size)
+		}
+	}
+}
+
+func TestWriteContentType(t *testing.T) {
+	_, store := setupFake(t, kodo.WithWritePartSize(4*1024*1024))
+
+	for _, size := range []int{1000, 8*1024*1024 + 1234} {
+		content := make([]byte, size)
+		rand.Read(content)
+
+		_, err := store.Write("typed", bytes.NewReader(content), int64(size), ps.WithContentType("text/plain"))
+		if err != nil {
+			t.Fatalf("write %d bytes: %v", size, err)
+		}
+		o, err := store.Stat("typed")
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if v, _ := o.GetContentType(); v != "text/plain" {
+			t.Errorf("expect content type text/plain for %d bytes, got %s", size, v)
+		}
+	}
+}
+
+func TestResumeWrite(t *testing.T) {
+	recorder, err := kodo.NewFileRecorder(t.TempDir())
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+	srv, store := setupFake(t,
+		kodo.WithWritePartSize(4*1024*1024),
+		kodo.WithUploadRecorder(recorder),
+	)
+
+	content := make([]byte, 16*1024*1024+1234)
+	rand.Read(content)
+
+	var mu sync.Mutex
+	var parts []string
+	failPart := true
+	srv.SetFault(func(r *http.Request) int {
+		if r.Method != http.MethodPut || !strings.Contains(r.URL.Path, "/uploads/") {
+			return 0
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		part := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if failPart && part == "3" {
+			return http.StatusBadRequest
+		}
+		parts = append(parts, part)
+		return 0
+	})
+
+	_, err = store.Write("resume", bytes.NewReader(content), int64(len(content)),
+		kodo.WithUploadSourceID("source"))
+	if err == nil {
+		t.Fatal("expect error while part 3 failed")
+	}
+
+	mu.Lock()
+	failPart = false
+	parts = nil
+	mu.Unlock()
+
+	n, err := store.Write("resume", bytes.NewReader(content), int64(len(content)),
+		kodo.WithUploadSourceID("source"))
+	if err != nil {
+		t.Fatalf("resume write: %v", err)
+	}
+	if n != int64(len(content)) {
+		t.Errorf("expect %d bytes written, got %d", len(content), n)
+	}
+	if strings.Join(parts, ",") != "3,4,5" {
+		t.Errorf("expect only parts 3,4,5 uploaded, got %v", parts)
+	}
+
+	data, ok := srv.GetObject(srv.Bucket, "resume")
+	if !ok || !bytes.Equal(data, content) {
+		t.Error("content mismatch")
+	}
+}
+
+func TestResumeWriteRecord(t *testing.T) {
+	recorder, err := kodo.NewFileRecorder(t.TempDir())
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+	srv, store := setupFake(t,
+		kodo.WithRetryMaxAttempts(1),
+		kodo.WithWritePartSize(4*1024*1024),
+		kodo.WithUploadRecorder(recorder),
+	)
+
+	var mu sync.Mutex
+	var parts []string
+	completeCode := 0
+	srv.SetFault(func(r *http.Request) int {
+		if !strings.Contains(r.URL.Path, "/uploads/") {
+			return 0
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method == http.MethodPost {
+			return completeCode
+		}
+		if r.Method == http.MethodPut {
+			parts = append(parts, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		}
+		return 0
+	})
+	write := func(content []byte, code int) (uploaded string, err error) {
+		mu.Lock()
+		parts, completeCode = nil, code
+		mu.Unlock()
+
+		_, err = store.Write("resume", bytes.NewReader(content), int64(len(content)),
+			kodo.WithUploadSourceID("source"))
+
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Join(parts, ","), err
+	}
+
+	content := make([]byte, 8*1024*1024+1234)
+	rand.Read(content)
+
+	// The record ends with a short part after complete failed.
+	if _, err = write(content, http.StatusServiceUnavailable); err == nil {
+		t.Fatal("expect error while complete failed")
+	}
+	uploaded, err := write(content, 0)
+	if err != nil || uploaded != "" {
+		t.Errorf("resume after complete failed: uploaded %q, %v", uploaded, err)
+	}
+	data, _ := srv.GetObject(srv.Bucket, "resume")
+	if !bytes.Equal(data, content) {
+		t.Error("content mismatch after resume")
+	}
+
+	// The record is deleted after complete failed permanently.
+	if _, err = write(content, http.StatusBadRequest); err == nil {
+		t.Fatal("expect error while complete failed")
+	}
+	uploaded, err = write(content, 0)
+	if err != nil || uploaded != "1,2,3" {
+		t.Errorf("write after complete failed permanently: uploaded %q, %v", uploaded, err)
+	}
+
+	// The record doesn't match shorter content, which is uploaded from the
+	// beginning.
+	if _, err = write(content, http.StatusServiceUnavailable); err == nil {
+		t.Fatal("expect error while complete failed")
+	}
+	uploaded, err = write(content[:6*1024*1024], 0)
+	if err != nil || uploaded != "1,2" {
+		t.Errorf("write shorter content: uploaded %q, %v", uploaded, err)
+	}
+	data, _ = srv.GetObject(srv.Bucket, "resume")
+	if !bytes.Equal(data, content[:6*1024*1024]) {
+		t.Error("content mismatch after write shorter content")
+	}
+}
+
+func TestWriteObject(t *testing.T) {
+	_, store := setupFake(t, kodo.WithWritePartSize(4*1024*1024))
+
+	for _, size := range []int{1000, 8*1024*1024 + 1234} {
+		content := make([]byte, size)
+		rand.Read(content)
+
+		o, err := store.WriteObject("object", bytes.NewReader(content), int64(size),
+			kodo.WithStorageClass(kodo.StorageClassStandardIA))
+		if err != nil {
+			t.Fatalf("write object of %d bytes: %v", size, err)
+		}
+
+		expect, err := store.Stat("object")
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if o.Path != "object" || o.ID != expect.ID {
+			t.Errorf("unexpected path %s and id %s", o.Path, o.ID)
+		}
+		if v, _ := o.GetContentLength(); v != int64(size) {
+			t.Errorf("expect size %d, got %d", size, v)
+		}
+		if v, _ := o.GetEtag(); v == "" || v != expect.MustGetEtag() {
+			t.Errorf("expect etag %s, got %s", expect.MustGetEtag(), v)
+		}
+		if v, _ := o.GetContentType(); v != expect.MustGetContentType() {
+			t.Errorf("expect content type %s, got %s", expect.MustGetContentType(), v)
+		}
+		sm := kodo.GetObjectSystemMetadata(o)
+		if sm.StorageClass != kodo.StorageClassStandardIA || sm != kodo.GetObjectSystemMetadata(expect) {
+			t.Errorf("unexpected storage class %d", sm.StorageClass)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package kodo
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/qiniu/go-sdk/v7/auth"
+	qs "github.com/qiniu/go-sdk/v7/storage"
+)
+
+const (
+	defaultUploadTokenLifetime = time.Hour
+	// maxCachedUploadTokens limits the tokens cached for different policies,
+	// all tokens will be dropped while it's exceeded.
+	maxCachedUploadTokens = 64
+)
+
+// UploadTokenFunc returns an upload token issued by others, like a central
+// service which holds the secret key.
+//
+// The token must be valid for the bucket of storager, and it's called before
+// every upload, so caching is up to the implementation. Token of bucket
+// scope could not overwrite existing objects. Put policy is decided by the
+// issuer, so put_policy and storage_class are not supported with it.
+type UploadTokenFunc func(ctx context.Context) (string, error)
+
+type cachedToken struct {
+	token    string
+	deadline time.Time
+}
+
+// tokenCache will cache upload tokens by their policies, and reissue them
+// before they expire.
+//
+// Signing a token requires serializing the policy, which is wasteful for
+// multipart uploads sending a request for every part. tokenCache is safe
+// for concurrent use.
+type tokenCache struct {
+	mac      *auth.Credentials
+	lifetime time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	// tokens is keyed by the policy without deadline.
+	tokens map[qs.PutPolicy]cachedToken
+}
+
+func newTokenCache(mac *auth.Credentials, lifetime time.Duration) *tokenCache {
+	return &tokenCache{
+		mac:      mac,
+		lifetime: lifetime,
+		now:      time.Now,
+		tokens:   make(map[qs.PutPolicy]cachedToken),
+	}
+}
+
+// uploadToken returns a token for the policy, which will be valid for at
+// least a quarter of the lifetime.
+func (c *tokenCache) uploadToken(p qs.PutPolicy) (string, error) {
+	// Deadline is set while signing, exclude it from the cache key.
+	p.Expires = 0
+	key := p
+
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.tokens[key]; ok && t.deadline.Sub(now) > c.lifetime/4 {
+		return t.token, nil
+	}
+
+	deadline := now.Add(c.lifetime)
+	p.Expires = uint64(deadline.Unix())
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	t := cachedToken{
+		token:    c.mac.SignWithData(data),
+		deadline: deadline,
+	}
+
+	if len(c.tokens) >= maxCachedUploadTokens {
+		c.tokens = make(map[qs.PutPolicy]cachedToken)
+	}
+	c.tokens[key] = t
+	return t.token, nil
+}
+
+// uploadToken returns the upload token for given policy.
+func (s *Storage) uploadToken(ctx context.Context, p qs.PutPolicy) (string, error) {
+	if s.tokenFunc != nil {
+		return s.tokenFunc(ctx)
+	}
+	if s.tokens == nil {
+		return "", errCredentialRequired
+	}
+	return s.tokens.uploadToken(p)
+}
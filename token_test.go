@@ -0,0 +1,86 @@
+package kodo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiniu/go-sdk/v7/auth/qbox"
+	qs "github.com/qiniu/go-sdk/v7/storage"
+)
+
+func newTestTokenCache(lifetime time.Duration) (*tokenCache, *time.Time) {
+	c := newTokenCache(qbox.NewMac("ak", "sk"), lifetime)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestTokenCacheConcurrent(t *testing.T) {
+	c := newTokenCache(qbox.NewMac("ak", "sk"), time.Hour)
+	p := qs.PutPolicy{Scope: "bucket"}
+
+	expected, err := c.uploadToken(p)
+	if err != nil {
+		t.Fatalf("upload token: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 32)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = c.uploadToken(p)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, v := range tokens {
+		if v != expected {
+			t.Errorf("token %d is not cached: %s", i, v)
+		}
+	}
+	if len(c.tokens) != 1 {
+		t.Errorf("expect 1 cached token, got %d", len(c.tokens))
+	}
+}
+
+func TestTokenCacheRefresh(t *testing.T) {
+	c, now := newTestTokenCache(time.Hour)
+	p := qs.PutPolicy{Scope: "bucket"}
+
+	first, _ := c.uploadToken(p)
+
+	// Token is reused while more than a quarter of lifetime remains.
+	*now = now.Add(44 * time.Minute)
+	if v, _ := c.uploadToken(p); v != first {
+		t.Errorf("token should be reused before refresh")
+	}
+
+	*now = now.Add(2 * time.Minute)
+	second, _ := c.uploadToken(p)
+	if second == first {
+		t.Errorf("token should be refreshed while less than a quarter of lifetime remains")
+	}
+	if v, _ := c.uploadToken(p); v != second {
+		t.Errorf("refreshed token should be cached")
+	}
+}
+
+func TestTokenCacheKeys(t *testing.T) {
+	c, _ := newTestTokenCache(time.Hour)
+
+	a, _ := c.uploadToken(qs.PutPolicy{Scope: "bucket"})
+	b, _ := c.uploadToken(qs.PutPolicy{Scope: "bucket", FsizeLimit: 1024})
+	if a == b {
+		t.Errorf("policies with different options should have different tokens")
+	}
+	// Expires is decided by the cache, so it's not a part of key.
+	if v, _ := c.uploadToken(qs.PutPolicy{Scope: "bucket", Expires: 60}); v != a {
+		t.Errorf("policy with expires should share the token")
+	}
+	if len(c.tokens) != 2 {
+		t.Errorf("expect 2 cached tokens, got %d", len(c.tokens))
+	}
+}
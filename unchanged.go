@@ -0,0 +1,140 @@
+package kodo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	qs "github.com/qiniu/go-sdk/v7/storage"
+)
+
+// maxBatchOps is the max count of operations in a batch request.
+//
+// ref: https://developer.qiniu.com/kodo/1250/batch
+const maxBatchOps = 1000
+
+// LocalObject describes local content to be compared with the remote object.
+type LocalObject struct {
+	// Path is the path of the remote object.
+	Path string
+	// Size is the size of content.
+	Size int64
+	// Etag is the qetag of content, which could be computed by QetagHash.
+	Etag string
+}
+
+// Unchanged reports whether content of every local object matches the
+// remote object by batch stat, so that unchanged files could be skipped in
+// sync without uploading them.
+//
+// Objects not existing or having an etag which is not a qetag are reported
+// as changed, so that they are uploaded again with a qetag. Failed stat of
+// other objects is returned as error.
+func (s *Storage) Unchanged(objects []LocalObject) (unchanged []bool, err error) {
+	ctx := context.Background()
+	return s.UnchangedWithContext(ctx, objects)
+}
+
+// UnchangedWithContext reports whether content of every local object
+// matches the remote object by batch stat.
+func (s *Storage) UnchangedWithContext(ctx context.Context, objects []LocalObject) (unchanged []bool, err error) {
+	defer func() {
+		err = s.formatError("unchanged", err)
+	}()
+
+	unchanged = make([]bool, len(objects))
+	for start := 0; start < len(objects); start += maxBatchOps {
+		end := start + maxBatchOps
+		if end > len(objects) {
+			end = len(objects)
+		}
+
+		keys := make([]string, 0, end-start)
+		for _, v := range objects[start:end] {
+			keys = append(keys, s.getAbsPath(v.Path))
+		}
+
+		var rets []batchStatResult
+		err = s.retry.do(ctx, func() (err error) {
+			rets, err = s.batchStat(ctx, keys)
+			if err != nil {
+				return err
+			}
+			return checkBatchStat(keys, rets)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i, ret := range rets {
+			if ret.Code != http.StatusOK {
+				continue
+			}
+			v := objects[start+i]
+			unchanged[start+i] = isUnchanged(ret.Data.FileInfo, v.Size, v.Etag)
+		}
+	}
+	return unchanged, nil
+}
+
+// checkBatchStat returns the error of the first failed operation in rets
+// of batch stat, objects not existing are not errors.
+func checkBatchStat(keys []string, rets []batchStatResult) error {
+	if len(rets) != len(keys) {
+		return fmt.Errorf("expect %d results of batch stat, got %d", len(keys), len(rets))
+	}
+	for i, ret := range rets {
+		if ret.Code == http.StatusOK || ret.Code == responseCodeResourceNotExist {
+			continue
+		}
+		// Request ID is of the whole batch, which is not known here.
+		return fmt.Errorf("stat %s: %w", keys[i], &ResponseError{Code: ret.Code, Message: ret.Data.Error})
+	}
+	return nil
+}
+
+// isUnchanged checks whether content with given size and etag is the same
+// as the remote object.
+func isUnchanged(fi qs.FileInfo, size int64, etag string) bool {
+	return fi.Fsize == size && isQetag(fi.Hash) && fi.Hash == etag
+}
+
+// checkUnchanged checks whether content in r is the same as the remote
+// object of key. Qetag of content is only computed while the remote object
+// has the same size and a qetag. r will be rewound to where it starts.
+func (s *Storage) checkUnchanged(ctx context.Context, key string, r io.ReadSeeker, size int64) (fi qs.FileInfo, unchanged bool, err error) {
+	err = s.retry.do(ctx, func() (err error) {
+		fi, err = s.statObject(ctx, key)
+		return err
+	})
+	if err != nil {
+		if checkError(err, responseCodeResourceNotExist) {
+			return fi, false, nil
+		}
+		return
+	}
+	if !isQetag(fi.Hash) || (size >= 0 && fi.Fsize != size) {
+		return fi, false, nil
+	}
+
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+
+	h := NewQetagHash()
+	var n int64
+	if size >= 0 {
+		n, err = io.CopyN(h, r, size)
+	} else {
+		n, err = io.Copy(h, r)
+	}
+	if err != nil {
+		return
+	}
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return
+	}
+	return fi, isUnchanged(fi, n, h.Etag()), nil
+}
@@ -0,0 +1,534 @@
+package kodo
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	qs "github.com/qiniu/go-sdk/v7/storage"
+
+	"github.com/beyondstorage/go-storage/v4/pkg/iowrap"
+)
+
+// Part size limits of multipart upload.
+//
+// ref: https://developer.qiniu.com/kodo/6365/initialize-multipartupload
+const (
+	minWritePartSize = 1024 * 1024
+	maxWritePartSize = 1024 * 1024 * 1024
+	// defaultWritePartSize is the same as the block size of qetag, so that
+	// the hash of object uploaded by parts is a qetag which could be verified.
+	defaultWritePartSize = qetagBlockSize
+)
+
+// putForm uploads content with known size by form upload, content is
+// written into h if it's not nil. mimeType is detected by kodo if it's empty.
+//
+// CRC32 of content is computed while streaming and sent by the uploader, so
+// that the server could reject corrupted uploads. Content is also verified
+// against sum, and the upload is aborted if it doesn't match.
+//
+// Upload is only retried while the reader could be rewound to where it starts.
+//
+// ref: https://developer.qiniu.com/kodo/1312/upload
+func (s *Storage) putForm(ctx context.Context, key string, r io.Reader, size int64,
+	putPolicy qs.PutPolicy, mimeType string, ioCallback func([]byte), h hash.Hash, sum contentChecksum) (body json.RawMessage, err error) {
+	uploader := qs.NewFormUploaderEx(s.bucket.Cfg, s.bucket.Client)
+
+	// Decode response as raw message, so that callback and return body could be returned as is.
+	put := func(r io.Reader) error {
+		// Content is verified while the uploader reads it to the end.
+		r = sum.reader(io.LimitReader(r, size))
+		if h != nil {
+			h.Reset()
+			r = io.TeeReader(r, h)
+		}
+		if ioCallback != nil {
+			r = iowrap.CallbackReader(r, ioCallback)
+		}
+
+		token, err := s.uploadToken(ctx, putPolicy)
+		if err != nil {
+			return err
+		}
+		host, err := s.upHost(ctx, token)
+		if err != nil {
+			return err
+		}
+		if err = s.dataLimiter.wait(ctx); err != nil {
+			return err
+		}
+		body = nil
+		return uploader.Put(ctx, &body, token, key, r, size, &qs.PutExtra{UpHost: host, MimeType: mimeType})
+	}
+
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		err = put(r)
+		return
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+
+	attempt := 0
+	err = s.retry.do(ctx, func() error {
+		attempt++
+		if attempt > 1 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		return put(r)
+	})
+	return
+}
+
+// contentChecksum is the precomputed checksums of content to upload, nil
+// fields are not verified.
+type contentChecksum struct {
+	crc32 *uint32
+	md5   []byte
+}
+
+// writer returns a checksumWriter computing the checksums to verify, nil is
+// returned if there is nothing to verify.
+func (c contentChecksum) writer() *checksumWriter {
+	if c.crc32 == nil && c.md5 == nil {
+		return nil
+	}
+	return &checksumWriter{
+		expect: c,
+		crc32:  crc32.NewIEEE(),
+		md5:    md5.New(),
+	}
+}
+
+// reader returns a reader which fails with ErrChecksumMismatch instead of
+// io.EOF if content read from r doesn't match, so that the upload reading
+// from it is aborted before finished. r is returned as is if there is
+// nothing to verify.
+func (c contentChecksum) reader(r io.Reader) io.Reader {
+	w := c.writer()
+	if w == nil {
+		return r
+	}
+	return &checksumReader{r: r, w: w}
+}
+
+// checksumWriter computes checksums of content written into it.
+type checksumWriter struct {
+	expect contentChecksum
+	crc32  hash.Hash32
+	md5    hash.Hash
+}
+
+func (w *checksumWriter) Write(p []byte) (n int, err error) {
+	_, _ = w.crc32.Write(p)
+	_, _ = w.md5.Write(p)
+	return len(p), nil
+}
+
+// verify returns ErrChecksumMismatch if content written doesn't match the
+// expected checksums, it does nothing for nil.
+func (w *checksumWriter) verify() error {
+	if w == nil {
+		return nil
+	}
+	if v := w.expect.crc32; v != nil && w.crc32.Sum32() != *v {
+		return fmt.Errorf("%w: expect crc32 %d, got %d", ErrChecksumMismatch, *v, w.crc32.Sum32())
+	}
+	if v := w.expect.md5; v != nil && !bytes.Equal(w.md5.Sum(nil), v) {
+		return fmt.Errorf("%w: expect md5 %s, got %s", ErrChecksumMismatch,
+			base64.StdEncoding.EncodeToString(v), base64.StdEncoding.EncodeToString(w.md5.Sum(nil)))
+	}
+	return nil
+}
+
+type checksumReader struct {
+	r io.Reader
+	w *checksumWriter
+}
+
+func (c *checksumReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	_, _ = c.w.Write(p[:n])
+	if err == io.EOF {
+		if verr := c.w.verify(); verr != nil {
+			return n, verr
+		}
+	}
+	return
+}
+
+// putStream uploads content by multipart upload, size < 0 means the size
+// is unknown.
+//
+// Content is read into a buffer of part size, and parts are uploaded one by
+// one, so that at most one part is held in memory. Content smaller than a
+// part is uploaded by form upload.
+//
+// If recorder is set and sourceID is not empty, progress is recorded after
+// every part, and the upload will be resumed from the record by skipping
+// uploaded content in r.
+//
+// All content including the skipped is written into h if it's not nil. It's
+// also verified against sum, and the upload is aborted before completed if
+// it doesn't match. Parts are verified by the server with their MD5.
+func (s *Storage) putStream(ctx context.Context, key string, r io.Reader, size int64, putPolicy qs.PutPolicy, mimeType string,
+	partSize int64, sourceID string, ioCallback func([]byte), h hash.Hash, sum contentChecksum) (n int64, body json.RawMessage, err error) {
+	var hashes []io.Writer
+	if h != nil {
+		hashes = append(hashes, h)
+	}
+	cw := sum.writer()
+	if cw != nil {
+		hashes = append(hashes, cw)
+	}
+	var hw io.Writer = ioutil.Discard
+	if len(hashes) > 0 {
+		hw = io.MultiWriter(hashes...)
+	}
+
+	var u *multipartUpload
+	var rec *uploadRecord
+	var recordKey string
+	if s.recorder != nil && sourceID != "" {
+		recordKey = s.uploadRecordKey(key, sourceID)
+		rec = s.loadUploadRecord(recordKey, partSize, size)
+	}
+
+	if rec != nil {
+		u = &multipartUpload{
+			s:         s,
+			putPolicy: putPolicy,
+			host:      rec.Host,
+			key:       key,
+			mimeType:  mimeType,
+			uploadID:  rec.UploadID,
+			parts:     rec.Parts,
+		}
+		n = rec.Offset
+		if err = skip(r, n, hw); err != nil {
+			// Content is shorter than the record, it could not be resumed.
+			_ = s.recorder.Delete(recordKey)
+			return 0, nil, fmt.Errorf("skip %d bytes recorded: %w", n, err)
+		}
+	}
+	if size >= 0 {
+		r = io.LimitReader(r, size-n)
+	}
+	if ioCallback != nil {
+		r = iowrap.CallbackReader(r, ioCallback)
+	}
+
+	defer func() {
+		// Keep the upload for resuming if it's recorded. Otherwise, parts
+		// uploaded will be cleaned up by kodo after expired, so the error of
+		// abort is ignored.
+		if err != nil && u != nil && rec == nil {
+			_ = u.abort(ctx)
+		}
+	}()
+
+	buf := make([]byte, partSize)
+	for {
+		read, rerr := io.ReadFull(r, buf)
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil && rerr != io.ErrUnexpectedEOF {
+			return n, nil, rerr
+		}
+		_, _ = hw.Write(buf[:read])
+
+		if u == nil {
+			if rerr == io.ErrUnexpectedEOF {
+				if size >= 0 && int64(read) != size {
+					return int64(read), nil, fmt.Errorf("expect %d bytes but got %d: %w", size, read, io.ErrUnexpectedEOF)
+				}
+				if err = cw.verify(); err != nil {
+					return int64(read), nil, err
+				}
+				body, err = s.putForm(ctx, key, bytes.NewReader(buf[:read]), int64(read), putPolicy, mimeType, nil, nil, contentChecksum{})
+				return int64(read), body, err
+			}
+
+			u, err = s.initMultipart(ctx, key, putPolicy, mimeType)
+			if err != nil {
+				return 0, nil, err
+			}
+			if recordKey != "" {
+				rec = &uploadRecord{
+					UploadID:  u.uploadID,
+					Host:      u.host,
+					PartSize:  partSize,
+					CreatedAt: time.Now().Unix(),
+				}
+			}
+		}
+
+		if rec != nil && n%partSize != 0 {
+			// Content is longer than the record which ends with a short part,
+			// it could not be resumed.
+			_ = s.recorder.Delete(recordKey)
+			rec = nil
+			return n, nil, fmt.Errorf("content is longer than the upload record of %d bytes", n)
+		}
+
+		err = u.uploadPart(ctx, len(u.parts)+1, buf[:read])
+		if err != nil {
+			return n, nil, err
+		}
+		n += int64(read)
+
+		if rec != nil {
+			rec.Parts = u.parts
+			rec.Offset = n
+			if err = s.saveUploadRecord(recordKey, rec); err != nil {
+				return n, nil, err
+			}
+		}
+	}
+
+	if size >= 0 && n != size {
+		return n, nil, fmt.Errorf("expect %d bytes but got %d: %w", size, n, io.ErrUnexpectedEOF)
+	}
+	if u == nil {
+		// Content is empty.
+		if err = cw.verify(); err != nil {
+			return 0, nil, err
+		}
+		body, err = s.putForm(ctx, key, bytes.NewReader(nil), 0, putPolicy, mimeType, nil, nil, contentChecksum{})
+		return 0, body, err
+	}
+
+	if err = cw.verify(); err != nil {
+		if rec != nil {
+			// Content of the source has been changed, it could not be resumed.
+			_ = s.recorder.Delete(recordKey)
+			rec = nil
+		}
+		return n, nil, err
+	}
+
+	body, err = u.complete(ctx)
+	if err != nil {
+		if rec != nil && !isRetryableError(err) {
+			// The upload could never be completed, so that it's aborted
+			// instead of being resumed.
+			_ = s.recorder.Delete(recordKey)
+			rec = nil
+		}
+		return n, nil, err
+	}
+	if rec != nil {
+		_ = s.recorder.Delete(recordKey)
+	}
+	return n, body, nil
+}
+
+// skip will skip n bytes of r. Skipped content is written into w if it's
+// not ioutil.Discard, so r could not be seeked in this case.
+func skip(r io.Reader, n int64, w io.Writer) error {
+	if n == 0 {
+		return nil
+	}
+	if w != ioutil.Discard {
+		_, err := io.CopyN(w, r, n)
+		return err
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err := seeker.Seek(n, io.SeekCurrent)
+		return err
+	}
+
+	_, err := io.CopyN(ioutil.Discard, r, n)
+	return err
+}
+
+// multipartUpload is an upload session of multipart upload.
+//
+// ref: https://developer.qiniu.com/kodo/6364/multipartupload-interface
+type multipartUpload struct {
+	s         *Storage
+	putPolicy qs.PutPolicy
+	host      string
+	key       string
+	// mimeType is detected by kodo if it's empty.
+	mimeType string
+	uploadID string
+	parts    []uploadedPart
+}
+
+type uploadedPart struct {
+	PartNumber int    `json:"partNumber"`
+	Etag       string `json:"etag"`
+}
+
+// upHost returns the up host of bucket for given upload token. It's given
+// to uploaders explicitly, so that they never query region without ctx.
+func (s *Storage) upHost(ctx context.Context, token string) (string, error) {
+	cfg := s.bucket.Cfg
+
+	// Upload token starts with the access key, which is required to query
+	// the region while the storager is created without credential.
+	idx := strings.Index(token, ":")
+	if idx < 0 {
+		return "", fmt.Errorf("invalid upload token")
+	}
+	zone, err := s.region(ctx, token[:idx])
+	if err != nil {
+		return "", err
+	}
+
+	scheme := "http://"
+	if cfg.UseHTTPS {
+		scheme = "https://"
+	}
+	hosts := zone.SrcUpHosts
+	if cfg.UseCdnDomains {
+		hosts = zone.CdnUpHosts
+	}
+	if len(hosts) == 0 {
+		return "", errors.New("empty up host list")
+	}
+	return scheme + hosts[0], nil
+}
+
+// ref: https://developer.qiniu.com/kodo/6365/initialize-multipartupload
+func (s *Storage) initMultipart(ctx context.Context, key string, putPolicy qs.PutPolicy, mimeType string) (u *multipartUpload, err error) {
+	token, err := s.uploadToken(ctx, putPolicy)
+	if err != nil {
+		return
+	}
+	host, err := s.upHost(ctx, token)
+	if err != nil {
+		return
+	}
+
+	u = &multipartUpload{
+		s:         s,
+		putPolicy: putPolicy,
+		host:      host,
+		key:       key,
+		mimeType:  mimeType,
+	}
+
+	var ret struct {
+		UploadID string `json:"uploadId"`
+	}
+	err = s.retry.do(ctx, func() error {
+		return u.call(ctx, &ret, http.MethodPost, u.url(), nil, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.uploadID = ret.UploadID
+	return u, nil
+}
+
+// ref: https://developer.qiniu.com/kodo/6366/upload-part
+//
+// MD5 of data is sent as Content-MD5, so that the server could reject
+// corrupted parts. Unlike mkblk and bput of the v1 resumable upload, upload
+// part doesn't accept or respond CRC32, so parts are not verified by CRC32.
+func (u *multipartUpload) uploadPart(ctx context.Context, partNumber int, data []byte) (err error) {
+	var ret struct {
+		Etag string `json:"etag"`
+		MD5  string `json:"md5"`
+	}
+	sum := md5.Sum(data)
+	contentMD5 := hex.EncodeToString(sum[:])
+	err = u.s.retry.do(ctx, func() error {
+		return u.call(ctx, &ret, http.MethodPut,
+			fmt.Sprintf("%s/%s/%d", u.url(), u.uploadID, partNumber), data, contentMD5)
+	})
+	if err != nil {
+		return
+	}
+	if ret.MD5 != "" && ret.MD5 != contentMD5 {
+		return fmt.Errorf("%w: expect md5 %s of part %d, got %s", ErrChecksumMismatch, contentMD5, partNumber, ret.MD5)
+	}
+
+	u.parts = append(u.parts, uploadedPart{PartNumber: partNumber, Etag: ret.Etag})
+	return nil
+}
+
+// ref: https://developer.qiniu.com/kodo/6368/complete-multipart-upload
+func (u *multipartUpload) complete(ctx context.Context) (body json.RawMessage, err error) {
+	req := map[string]interface{}{
+		"parts": u.parts,
+		"fname": u.key,
+	}
+	if u.mimeType != "" {
+		req["mimeType"] = u.mimeType
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+
+	err = u.s.retry.do(ctx, func() error {
+		body = nil
+		return u.call(ctx, &body, http.MethodPost, fmt.Sprintf("%s/%s", u.url(), u.uploadID), data, "")
+	})
+	return
+}
+
+// ref: https://developer.qiniu.com/kodo/6367/abort-multipart-upload
+func (u *multipartUpload) abort(ctx context.Context) error {
+	return u.call(ctx, nil, http.MethodDelete, fmt.Sprintf("%s/%s", u.url(), u.uploadID), nil, "")
+}
+
+// url returns the url of uploads like `<host>/buckets/<bucket>/objects/<encoded key>/uploads`.
+func (u *multipartUpload) url() string {
+	return fmt.Sprintf("%s/buckets/%s/objects/%s/uploads",
+		u.host, u.s.name, base64.URLEncoding.EncodeToString([]byte(u.key)))
+}
+
+// call sends a request authorized by upload token, contentMD5 is sent if
+// it's not empty.
+func (u *multipartUpload) call(ctx context.Context, ret interface{}, method, reqURL string, data []byte, contentMD5 string) error {
+	token, err := u.s.uploadToken(ctx, u.putPolicy)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+	if err = u.s.dataLimiter.wait(ctx); err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "UpToken "+token)
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	} else if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if contentMD5 != "" {
+		req.Header.Set("Content-MD5", contentMD5)
+	}
+
+	return doRequest(ctx, u.s.bucket.Client, req, ret)
+}
@@ -1,11 +1,13 @@
 package kodo
 
 import (
+	"context"
+	"errors"
 	"fmt"
-
 	"strings"
 	"time"
 
+	"github.com/qiniu/go-sdk/v7/auth"
 	"github.com/qiniu/go-sdk/v7/auth/qbox"
 	qc "github.com/qiniu/go-sdk/v7/client"
 	qs "github.com/qiniu/go-sdk/v7/storage"
@@ -20,7 +22,12 @@ import (
 
 // Service is the kodo config.
 type Service struct {
-	service *qs.BucketManager
+	service   *qs.BucketManager
+	ucHost    string
+	retry     retryer
+	anonymous bool
+
+	metadataLimiter *requestLimiter
 
 	defaultPairs DefaultServicePairs
 	features     ServiceFeatures
@@ -36,8 +43,30 @@ func (s *Service) String() string {
 // Storage is the gcs service client.
 type Storage struct {
 	bucket    *qs.BucketManager
-	domain    string
+	ucHost    string
+	regions   regionCache
+	domains   *domainPool
 	putPolicy qs.PutPolicy // kodo need PutPolicy to generate upload token.
+	tokens    *tokenCache
+	tokenFunc UploadTokenFunc
+	anonymous bool // anonymous storager could only read from public bucket.
+
+	clock            *clock
+	urlLifetime      time.Duration
+	timestampAuthKey string // timestampAuthKey is the key of cdn timestamp anti-leech.
+
+	readConcurrency    int
+	readPartSize       int64
+	readResumeAttempts int
+	writePartSize      int64
+	recorder           Recorder
+	uploadRecordExpiry time.Duration
+	readLimiter        *rateLimiter
+	writeLimiter       *rateLimiter
+	metadataLimiter    *requestLimiter
+	dataLimiter        *requestLimiter
+	observer           Observer
+	retry              retryer
 
 	name    string
 	workDir string
@@ -73,6 +102,10 @@ func NewStorager(pairs ...typ.Pair) (typ.Storager, error) {
 	return store, err
 }
 
+// credentialAnonymous is the credential for public buckets, which could be
+// used to read objects without access key and secret key.
+const credentialAnonymous = "anonymous"
+
 func newServicer(pairs ...typ.Pair) (srv *Service, err error) {
 	defer func() {
 		if err != nil {
@@ -87,19 +120,63 @@ func newServicer(pairs ...typ.Pair) (srv *Service, err error) {
 		return nil, err
 	}
 
-	cp, err := credential.Parse(opt.Credential)
-	if err != nil {
-		return nil, err
-	}
-	if cp.Protocol() != credential.ProtocolHmac {
-		return nil, services.PairUnsupportedError{Pair: ps.WithCredential(opt.Credential)}
+	// Credential could be omitted while storager is created with upload
+	// token, or be anonymous for public buckets. All operations which need
+	// the secret key will be denied for them.
+	var mac *auth.Credentials
+	switch {
+	case opt.HasCredential && opt.Credential == credentialAnonymous:
+		srv.anonymous = true
+	case opt.HasCredential:
+		cp, err := credential.Parse(opt.Credential)
+		if err != nil {
+			return nil, err
+		}
+		if cp.Protocol() != credential.ProtocolHmac {
+			return nil, services.PairUnsupportedError{Pair: ps.WithCredential(opt.Credential)}
+		}
+		ak, sk := cp.Hmac()
+		mac = qbox.NewMac(ak, sk)
 	}
-	ak, sk := cp.Hmac()
 
-	mac := qbox.NewMac(ak, sk)
 	cfg := &qs.Config{}
-	srv.service = qs.NewBucketManager(mac, cfg)
-	srv.service.Client.Client = httpclient.New(opt.HTTPClientOptions)
+	hc := httpclient.New(opt.HTTPClientOptions)
+	if opt.HasLogger {
+		hc.Transport = logTransport{base: hc.Transport, logger: opt.Logger}
+	}
+	hc.Transport = traceTransport{base: hc.Transport}
+	clt := &qc.Client{Client: hc}
+	srv.service = qs.NewBucketManagerEx(mac, cfg, clt)
+	srv.ucHost = qs.UcHost
+	if !strings.Contains(srv.ucHost, "://") {
+		srv.ucHost = "https://" + srv.ucHost
+	}
+	if opt.HasAPIEndpoint {
+		err = srv.setAPIEndpoint(opt.APIEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	srv.retry = newRetryer()
+	if opt.HasRetryMaxAttempts {
+		if opt.RetryMaxAttempts < 1 {
+			return nil, services.PairUnsupportedError{Pair: WithRetryMaxAttempts(opt.RetryMaxAttempts)}
+		}
+		srv.retry.maxAttempts = opt.RetryMaxAttempts
+	}
+	if opt.HasRetryMaxDelay {
+		if opt.RetryMaxDelay < 0 {
+			return nil, services.PairUnsupportedError{Pair: WithRetryMaxDelay(opt.RetryMaxDelay)}
+		}
+		srv.retry.maxDelay = time.Duration(opt.RetryMaxDelay) * time.Millisecond
+	}
+	if opt.HasMetadataQPS {
+		if opt.MetadataQPS <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithMetadataQPS(opt.MetadataQPS)}
+		}
+		srv.metadataLimiter = newRequestLimiter(opt.MetadataQPS)
+	}
 
 	if opt.HasDefaultServicePairs {
 		srv.defaultPairs = opt.DefaultServicePairs
@@ -110,6 +187,46 @@ func newServicer(pairs ...typ.Pair) (srv *Service, err error) {
 	return
 }
 
+// setAPIEndpoint will send all kodo apis to the given endpoint instead of
+// the hosts queried from uc.
+func (s *Service) setAPIEndpoint(v string) error {
+	ep, err := endpoint.Parse(v)
+	if err != nil {
+		return err
+	}
+
+	var url, host string
+	var port int
+	switch ep.Protocol() {
+	case endpoint.ProtocolHTTPS:
+		url, host, port = ep.HTTPS()
+		s.service.Cfg.UseHTTPS = true
+	case endpoint.ProtocolHTTP:
+		url, host, port = ep.HTTP()
+	default:
+		return services.PairUnsupportedError{Pair: WithAPIEndpoint(v)}
+	}
+	host = fmt.Sprintf("%s:%d", host, port)
+
+	cfg := s.service.Cfg
+	cfg.Zone = &qs.Region{
+		SrcUpHosts: []string{host},
+		CdnUpHosts: []string{host},
+		RsHost:     host,
+		RsfHost:    host,
+		ApiHost:    host,
+		IovipHost:  host,
+	}
+	cfg.RsHost = url
+	cfg.RsfHost = url
+	cfg.ApiHost = url
+	cfg.IoHost = url
+	cfg.UpHost = url
+	cfg.CentralRsHost = host
+	s.ucHost = url
+	return nil
+}
+
 func newServicerAndStorager(pairs ...typ.Pair) (srv *Service, store *Storage, err error) {
 	srv, err = newServicer(pairs...)
 	if err != nil {
@@ -128,7 +245,8 @@ func convertUnixTimestampToTime(v int64) time.Time {
 	if v == 0 {
 		return time.Time{}
 	}
-	return time.Unix(v, 0)
+	// putTime returned by kodo is in 100 nanoseconds.
+	return time.Unix(0, v*100)
 }
 
 // All available storage classes are listed here.
@@ -141,24 +259,57 @@ const (
 
 // ref: https://developer.qiniu.com/kodo/api/3928/error-responses
 func formatError(err error) error {
-	if _, ok := err.(services.InternalError); ok {
+	var ie services.InternalError
+	if errors.As(err, &ie) {
+		return err
+	}
+	if err == errCredentialRequired || errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrChecksumUnverifiable) {
+		return err
+	}
+	// Keep context errors in the chain, so that callers could tell them
+	// by errors.Is.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 		return err
 	}
 
-	e, ok := err.(*qc.ErrorInfo)
-	if !ok {
+	// Errors could be wrapped with more context, like the failed part.
+	var re *ResponseError
+	var ei *qc.ErrorInfo
+	switch {
+	case errors.As(err, &re):
+		// Classify in place, so that the context of wrapping is kept.
+		re.err = classifyErrorCode(re.Code)
+		return err
+	case errors.As(err, &ei):
+		e := convertErrorInfo(ei)
+		e.err = classifyErrorCode(e.Code)
+		return e
+	default:
 		return fmt.Errorf("%w, %v", services.ErrUnexpected, err)
 	}
+}
 
+// classifyErrorCode converts error code returned by kodo into errors defined in services.
+func classifyErrorCode(code int) error {
 	// error code returned by kodo looks like http status code, but it's not.
 	// kodo could return 6xx or 7xx for their costumed errors.
-	switch e.Code {
-	case responseCodeResourceNotExist:
-		return fmt.Errorf("%w: %v", services.ErrObjectNotExist, err)
+	switch code {
+	case responseCodeNotFound, responseCodeResourceNotExist:
+		return services.ErrObjectNotExist
 	case responseCodePermissionDenied:
-		return fmt.Errorf("%w: %v", services.ErrPermissionDenied, err)
+		return services.ErrPermissionDenied
+	case responseCodeRequestThrottled:
+		return services.ErrRequestThrottled
+	case responseCodeCrc32Mismatch:
+		return ErrChecksumMismatch
+	case responseCodeInternalError,
+		responseCodeBadGateway,
+		responseCodeServiceUnavailable,
+		responseCodeGatewayTimeout,
+		responseCodeServerOperationFailed:
+		return services.ErrServiceInternal
 	default:
-		return fmt.Errorf("%w, %v", services.ErrUnexpected, err)
+		return services.ErrUnexpected
 	}
 }
 
@@ -168,17 +319,33 @@ func formatError(err error) error {
 const (
 	// responseCodeResourceNotExist is an error code that is returned if insufficient permissions and access denied.
 	responseCodePermissionDenied = 403
+	// responseCodeNotFound is an error code that is returned by download domain if the object does not exist.
+	responseCodeNotFound = 404
+	// responseCodeInternalError is an error code that is returned if kodo meets an internal error.
+	responseCodeInternalError = 500
+	// responseCodeBadGateway is an error code that is returned if kodo's gateway failed to reach the upstream.
+	responseCodeBadGateway = 502
+	// responseCodeServiceUnavailable is an error code that is returned if kodo is temporarily unavailable.
+	responseCodeServiceUnavailable = 503
+	// responseCodeGatewayTimeout is an error code that is returned if kodo's gateway timed out on the upstream.
+	responseCodeGatewayTimeout = 504
+	// responseCodeCrc32Mismatch is an error code that is returned if CRC32 of uploaded content doesn't match.
+	responseCodeCrc32Mismatch = 406
+	// responseCodeRequestThrottled is an error code that is returned if the request frequency is too high.
+	responseCodeRequestThrottled = 573
+	// responseCodeServerOperationFailed is an error code that is returned if the server side operation failed.
+	responseCodeServerOperationFailed = 599
 	// responseCodeResourceNotExist is an error code that is returned if the specified resource does not exist or has been deleted.
 	responseCodeResourceNotExist = 612
 )
 
 func checkError(err error, code int) bool {
-	e, ok := err.(*qc.ErrorInfo)
+	c, ok := getErrorCode(err)
 	if !ok {
 		return false
 	}
 
-	return e.Code == code
+	return c == code
 }
 
 // newStorage will create a new client.
@@ -188,31 +355,142 @@ func (s *Service) newStorage(pairs ...typ.Pair) (store *Storage, err error) {
 		return nil, err
 	}
 
-	ep, err := endpoint.Parse(opt.Endpoint)
-	if err != nil {
-		return nil, err
+	var endpoints []string
+	if opt.HasEndpoint {
+		endpoints = append(endpoints, opt.Endpoint)
+	}
+	endpoints = append(endpoints, opt.Endpoints...)
+	if len(endpoints) == 0 {
+		return nil, services.PairRequiredError{Keys: []string{ps.WithEndpoint("").Key}}
 	}
 
-	var url string
-	switch ep.Protocol() {
-	case endpoint.ProtocolHTTPS:
-		url, _, _ = ep.HTTPS()
-	case endpoint.ProtocolHTTP:
-		url, _, _ = ep.HTTP()
-	default:
-		return nil, services.PairUnsupportedError{Pair: ps.WithEndpoint(opt.Endpoint)}
+	cooldown := defaultEndpointCooldown
+	if opt.HasEndpointCooldown {
+		if opt.EndpointCooldown < 0 {
+			return nil, services.PairUnsupportedError{Pair: WithEndpointCooldown(opt.EndpointCooldown)}
+		}
+		cooldown = time.Duration(opt.EndpointCooldown) * time.Second
+	}
+	domains, err := newDomainPool(endpoints, cooldown)
+	if err != nil {
+		return nil, err
 	}
 
 	store = &Storage{
-		bucket: s.service,
-		domain: url,
-		putPolicy: qs.PutPolicy{
-			Scope: opt.Name,
-		},
+		bucket:    s.service,
+		ucHost:    s.ucHost,
+		domains:   domains,
+		retry:     s.retry,
+		anonymous: s.anonymous,
+
+		metadataLimiter: s.metadataLimiter,
 
 		name:    opt.Name,
 		workDir: "/",
 	}
+	store.putPolicy = store.newPutPolicy(PutPolicy{})
+
+	lifetime := defaultUploadTokenLifetime
+	if opt.HasUploadTokenLifetime {
+		if opt.UploadTokenLifetime <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithUploadTokenLifetime(opt.UploadTokenLifetime)}
+		}
+		lifetime = time.Duration(opt.UploadTokenLifetime) * time.Second
+	}
+	switch {
+	case opt.HasUploadTokenFunc:
+		store.tokenFunc = opt.UploadTokenFunc
+	case opt.HasUploadToken:
+		token := opt.UploadToken
+		store.tokenFunc = func(ctx context.Context) (string, error) {
+			return token, nil
+		}
+	case s.service.Mac != nil:
+		store.tokens = newTokenCache(s.service.Mac, lifetime)
+	case s.anonymous:
+		// Anonymous storager is read only, no upload token is available.
+	default:
+		return nil, services.PairRequiredError{Keys: []string{ps.WithCredential("").Key}}
+	}
+
+	store.urlLifetime = defaultURLLifetime
+	if opt.HasURLLifetime {
+		if opt.URLLifetime <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithURLLifetime(opt.URLLifetime)}
+		}
+		store.urlLifetime = time.Duration(opt.URLLifetime) * time.Second
+	}
+	store.readConcurrency = defaultReadConcurrency
+	if opt.HasReadConcurrency {
+		if opt.ReadConcurrency < 1 {
+			return nil, services.PairUnsupportedError{Pair: WithReadConcurrency(opt.ReadConcurrency)}
+		}
+		store.readConcurrency = opt.ReadConcurrency
+	}
+	store.readPartSize = defaultReadPartSize
+	if opt.HasReadPartSize {
+		if opt.ReadPartSize <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithReadPartSize(opt.ReadPartSize)}
+		}
+		store.readPartSize = opt.ReadPartSize
+	}
+	store.readResumeAttempts = defaultReadResumeAttempts
+	if opt.HasReadResumeAttempts {
+		if opt.ReadResumeAttempts < 0 {
+			return nil, services.PairUnsupportedError{Pair: WithReadResumeAttempts(opt.ReadResumeAttempts)}
+		}
+		store.readResumeAttempts = opt.ReadResumeAttempts
+	}
+	store.writePartSize = defaultWritePartSize
+	if opt.HasWritePartSize {
+		if opt.WritePartSize < minWritePartSize || opt.WritePartSize > maxWritePartSize {
+			return nil, services.PairUnsupportedError{Pair: WithWritePartSize(opt.WritePartSize)}
+		}
+		store.writePartSize = opt.WritePartSize
+	}
+	if opt.HasUploadRecorder {
+		store.recorder = opt.UploadRecorder
+	}
+	store.uploadRecordExpiry = defaultUploadRecordExpiry
+	if opt.HasUploadRecordExpiry {
+		if opt.UploadRecordExpiry <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithUploadRecordExpiry(opt.UploadRecordExpiry)}
+		}
+		store.uploadRecordExpiry = time.Duration(opt.UploadRecordExpiry) * time.Second
+	}
+	if opt.HasReadRateLimit {
+		if opt.ReadRateLimit <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithReadRateLimit(opt.ReadRateLimit)}
+		}
+		store.readLimiter = newRateLimiter(opt.ReadRateLimit)
+	}
+	if opt.HasWriteRateLimit {
+		if opt.WriteRateLimit <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithWriteRateLimit(opt.WriteRateLimit)}
+		}
+		store.writeLimiter = newRateLimiter(opt.WriteRateLimit)
+	}
+	if opt.HasMetadataQPS {
+		if opt.MetadataQPS <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithMetadataQPS(opt.MetadataQPS)}
+		}
+		store.metadataLimiter = newRequestLimiter(opt.MetadataQPS)
+	}
+	if opt.HasDataQPS {
+		if opt.DataQPS <= 0 {
+			return nil, services.PairUnsupportedError{Pair: WithDataQPS(opt.DataQPS)}
+		}
+		store.dataLimiter = newRequestLimiter(opt.DataQPS)
+	}
+	if opt.HasObserver {
+		store.observer = opt.Observer
+	}
+	if opt.HasTimestampAuthKey {
+		store.timestampAuthKey = opt.TimestampAuthKey
+	}
+	// Configured clock skew is authoritative, so that it won't be overwritten
+	// by the detected one.
+	store.clock = newClock(time.Duration(opt.ClockSkew)*time.Second, opt.DetectClockSkew && !opt.HasClockSkew)
 
 	if opt.HasDefaultStoragePairs {
 		store.defaultPairs = opt.DefaultStoragePairs
@@ -223,6 +501,27 @@ func (s *Service) newStorage(pairs ...typ.Pair) (store *Storage, err error) {
 	if opt.HasWorkDir {
 		store.workDir = opt.WorkDir
 	}
+	if opt.HasPutPolicy {
+		if store.tokenFunc != nil {
+			return nil, services.PairUnsupportedError{Pair: WithPutPolicy(opt.PutPolicy)}
+		}
+		if err = opt.PutPolicy.validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", services.PairUnsupportedError{Pair: WithPutPolicy(opt.PutPolicy)}, err)
+		}
+		store.putPolicy = store.newPutPolicy(opt.PutPolicy)
+	}
+	if opt.HasRetryMaxAttempts {
+		if opt.RetryMaxAttempts < 1 {
+			return nil, services.PairUnsupportedError{Pair: WithRetryMaxAttempts(opt.RetryMaxAttempts)}
+		}
+		store.retry.maxAttempts = opt.RetryMaxAttempts
+	}
+	if opt.HasRetryMaxDelay {
+		if opt.RetryMaxDelay < 0 {
+			return nil, services.PairUnsupportedError{Pair: WithRetryMaxDelay(opt.RetryMaxDelay)}
+		}
+		store.retry.maxDelay = time.Duration(opt.RetryMaxDelay) * time.Millisecond
+	}
 	return store, nil
 }
 
@@ -287,6 +586,23 @@ func (s *Storage) formatFileObject(v qs.ListItem) (o *typ.Object, err error) {
 	return
 }
 
+// setFileInfo fills o with the stat result.
+func setFileInfo(o *typ.Object, fi qs.FileInfo) {
+	o.SetLastModified(convertUnixTimestampToTime(fi.PutTime))
+	o.SetContentLength(fi.Fsize)
+
+	if fi.Hash != "" {
+		o.SetEtag(fi.Hash)
+	}
+	if fi.MimeType != "" {
+		o.SetContentType(fi.MimeType)
+	}
+
+	var sm ObjectSystemMetadata
+	sm.StorageClass = fi.Type
+	o.SetSystemMetadata(sm)
+}
+
 func (s *Storage) newObject(done bool) *typ.Object {
 	return typ.NewObject(s, done)
 }
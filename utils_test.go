@@ -0,0 +1,18 @@
+package kodo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConvertUnixTimestampToTime(t *testing.T) {
+	if got := convertUnixTimestampToTime(0); !got.IsZero() {
+		t.Errorf("expect zero time, got %v", got)
+	}
+
+	// putTime returned by kodo is in 100 nanoseconds.
+	expect := time.Date(2021, 6, 29, 8, 30, 15, 123456700, time.UTC)
+	if got := convertUnixTimestampToTime(16249554151234567); !got.Equal(expect) {
+		t.Errorf("expect %v, got %v", expect, got)
+	}
+}